@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/momentum-xyz/posbus-client/pbc/replay"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+)
+
+func main() {
+	speed := flag.Float64("speed", 1, "Playback speed, relative to the recording (0 for no delays)")
+	step := flag.Bool("step", false, "Play one message at a time, press enter for the next")
+	serve := flag.String("serve", "", "Serve the recording as a posbus websocket on this address, e.g. localhost:4001")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <capture file>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	rec, err := replay.LoadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("Load: %s", err)
+	}
+
+	p := rec.Player(*speed)
+	if *step {
+		in := bufio.NewScanner(os.Stdin)
+		for in.Scan() {
+			if err := p.Step(printMessage); err != nil {
+				if errors.Is(err, replay.ErrInvalidFrame) {
+					log.Println(err)
+					continue
+				}
+				if err != io.EOF {
+					log.Fatalf("Replay: %s", err)
+				}
+				break
+			}
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *serve != "" {
+		srv := &http.Server{Addr: *serve, Handler: rec.Handler(*speed)}
+		go func() {
+			<-ctx.Done()
+			srv.Close()
+		}()
+		fmt.Printf("Serving %d frames on ws://%s\n", len(rec.Frames), *serve)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Serve: %s", err)
+		}
+		return
+	}
+
+	for {
+		err := p.Play(ctx, printMessage)
+		if errors.Is(err, replay.ErrInvalidFrame) {
+			// Skip it, and play on.
+			log.Println(err)
+			continue
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Fatalf("Replay: %s", err)
+		}
+		return
+	}
+}
+
+func printMessage(msg posbus.Message) {
+	fmt.Printf("%s: %+v\n", posbus.MessageNameById(msg.GetType()), msg)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/momentum-xyz/posbus-client/pbc"
+	"github.com/momentum-xyz/posbus-client/pbc/api"
+	"github.com/momentum-xyz/posbus-client/pbc/capture"
+	"github.com/momentum-xyz/posbus-client/pbc/pbcprom"
+	"github.com/momentum-xyz/posbus-client/pbc/state"
+	"github.com/momentum-xyz/posbus-client/test/scenarios"
+	"github.com/momentum-xyz/ubercontroller/logger"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/universe/logic/api/dto"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap/zapcore"
+)
+
+// Connect to a world, optionally with some fake users flying around.
+func runConnect(args []string) {
+	fs := flag.NewFlagSet("connect", flag.ExitOnError)
+	backendArg := fs.String("backend", "http://localhost:4000", "The URL to the controller backend")
+	worldArg := fs.String("world", "975cb9ca-4dfa-4d35-adc2-198ed1f12555", "UUID of a world")
+	token := fs.String("token", "", "An authentication token")
+	nrFlyers := fs.Uint64("nrFlyers", 0, "Number of fake users to create that fly around randomly (see the load command for more)")
+	h5s := fs.Bool("h5s", false, "High five fake users")
+	logLevel := fs.String("log", "warn", "Log level (warn, info, debug")
+	maxRetries := fs.Int("maxRetries", 0, "Give up reconnecting after this many retries (0 is unlimited, -1 is never reconnect)")
+	record := fs.String("record", "", "Record the connection to a capture file")
+	interactive := fs.Bool("i", false, "Interactive shell, once connected")
+	metricsAddr := fs.String("metrics-addr", "", "Serve Prometheus metrics of the connection on this address (e.g. :9100), at /metrics")
+	fs.Parse(args)
+	verbose.Store(!*interactive)
+	backend, err := url.Parse(*backendArg)
+	if err != nil {
+		log.Fatalf("Invalid backend URL %s", err)
+	}
+	world, err := umid.Parse(*worldArg)
+	if err != nil {
+		log.Fatalf("Invalid world %s", err)
+	}
+
+	l, err := zapcore.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatalf("Invalid log level %s", err)
+	}
+	logger.SetLevel(l)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	backendAPI := api.NewClient(backend, api.WithToken(*token))
+	var user *dto.User
+	if *token != "" {
+		user, err = backendAPI.Me(ctx)
+		if err != nil {
+			log.Fatalf("user of token: %s", err)
+		}
+	} else {
+		user, err = backendAPI.GuestToken(ctx)
+		if err != nil {
+			log.Fatalf("guest user: %s", err)
+		}
+	}
+
+	//fmt.Printf("%+v\n", u)
+
+	// 'viewer' for the ouput
+	var clientOpts []pbc.Option
+	switch {
+	case *maxRetries < 0:
+		clientOpts = append(clientOpts, pbc.WithReconnectPolicy(pbc.NeverReconnect))
+	case *maxRetries > 0:
+		policy := pbc.DefaultReconnectPolicy()
+		policy.MaxAttempts = *maxRetries
+		clientOpts = append(clientOpts, pbc.WithReconnectPolicy(policy))
+	}
+
+	// Only the 'viewer' is recorded, not the flyers.
+	viewerOpts := clientOpts
+	var recorder *capture.Writer
+	if *record != "" {
+		recorder, err = capture.Create(*record)
+		if err != nil {
+			log.Fatalf("record: %s", err)
+		}
+		viewerOpts = append(viewerOpts[:len(viewerOpts):len(viewerOpts)], pbc.WithRecorder(recorder))
+	}
+	if *metricsAddr != "" {
+		metrics := pbcprom.NewCollector(nil)
+		prometheus.MustRegister(metrics)
+		viewerOpts = append(viewerOpts[:len(viewerOpts):len(viewerOpts)], pbc.WithMetrics(metrics))
+		go serveMetrics(*metricsAddr)
+	}
+	client := pbc.NewClient(viewerOpts...)
+	client.OnStateChange(func(sc pbc.StateChange) {
+		log.Printf("Connection %s -> %s (%v)\n", sc.From, sc.To, sc.Cause)
+	})
+	client.OnResume(func(r pbc.Resume) {
+		log.Printf("Resumed after %s: +%d/-%d objects, +%d/-%d users, %d locks lost\n",
+			r.Downtime, len(r.AddedObjects), len(r.RemovedObjects), len(r.AddedUsers), len(r.RemovedUsers), len(r.LocksLost))
+	})
+	wState := state.New(user.ID)
+	client.SetCallback(nil)
+	client.OnAny(wState.Handle)
+	pbc.On(client, func(m *posbus.AddObjects) {
+		if len(m.Objects) > 0 && verbose.Load() {
+			objDef := m.Objects[rand.Intn(len(m.Objects))]
+			log.Printf("Object %v in %v", objDef, wState.Info())
+		}
+	})
+	msgLogging(client)
+	pbURL := backendAPI.PosbusURL()
+	log.Printf("Connecting to %s as %s\n", pbURL, user.Name)
+	if err := client.Connect(ctx, pbURL, backendAPI.Token(), user.ID); err != nil {
+		log.Fatalf("connect: %s", err)
+	}
+
+	log.Printf("Teleporting %v to %s\n", user.Name, world)
+	summary, err := client.Teleport(ctx, world)
+	if err != nil {
+		log.Fatalf("teleport: %s", err)
+	}
+	log.Printf("Loaded world %s in %s: %d objects, %d users\n", summary.Name, summary.LoadTime, summary.Objects, summary.Users)
+
+	// Run some fake users.
+	// "poor man's" load test, just for some quick local testing :)
+	// TODO: Use a proper testing framework, to not reinvent the wheel here.
+	var wg sync.WaitGroup
+	const rampUp = 420 * time.Millisecond
+	log.Printf("Starting %d flyers...", *nrFlyers)
+	for i := uint64(0); i < *nrFlyers; i++ {
+		if ctx.Err() == nil {
+			wg.Add(1)
+			go func(i uint64) {
+				defer wg.Done()
+				scenarios.GuestFlyer(ctx, i, backend, &world, clientOpts...)
+			}(i)
+			time.Sleep(rampUp)
+		}
+	}
+	log.Println("done!")
+
+	if *h5s {
+		// Randomly h5 users
+		go func() {
+			step := 5000 * time.Millisecond
+			ticker := time.NewTicker(step)
+			for {
+				select {
+				case <-ctx.Done():
+					ticker.Stop()
+					return
+				case <-ticker.C:
+					wUsers := wState.Users()
+					if len(wUsers) == 0 {
+						continue
+					}
+					ru := wUsers[rand.Intn(len(wUsers))]
+					if ru.ID == user.ID {
+						continue
+					}
+					//fmt.Printf("H5 %s\n", ru.ID)
+					if err := client.HighFive(ctx, ru.ID, "H5!"); err != nil {
+						log.Printf("H5: %s\n", err)
+					}
+				}
+			}
+		}()
+
+	}
+
+	/* example reconnect:
+	time.Sleep(time.Second * 3)
+	cancelConnection()
+
+	time.Sleep(time.Second * 3)
+	client.Connect(ctx, URL, *u.JWTToken, uuid.MustParse(u.ID))
+	*/
+	//client.LockObject(ctx, objectID)
+
+	if *interactive {
+		newRepl(client, wState, os.Stdout).Run(ctx, os.Stdin)
+	} else {
+		<-ctx.Done()
+	}
+	client.Close()
+	if recorder != nil {
+		if err := recorder.Close(); err != nil {
+			log.Printf("record: %s\n", err)
+		}
+	}
+	fmt.Println("Stopped.")
+}
+
+func msgLogging(client *pbc.Client) {
+	pbc.On(client, onSignal)
+	pbc.On(client, func(m *posbus.AddObjects) {
+		logVerbose("Add %d objects\n", len(m.Objects))
+	})
+	pbc.On(client, func(m *posbus.AddUsers) {
+		logVerbose("Add %d users\n", len(m.Users))
+	})
+	pbc.On(client, func(m *posbus.AttributeValueChanged) {
+		logVerbose("Attribute value changed: %+v\n", m)
+	})
+	pbc.On(client, func(m *posbus.ObjectTransform) {
+		logVerbose("Object transform: %+v\n", m)
+	})
+	pbc.On(client, func(m *posbus.HighFive) {
+		logVerbose("H5: %+v\n", m)
+	})
+}
+
+func logVerbose(format string, args ...any) {
+	if verbose.Load() {
+		fmt.Printf(format, args...)
+	}
+}
+
+func onSignal(sig *posbus.Signal) {
+	switch sig.Value {
+	case posbus.SignalNone:
+		log.Println("none signal received")
+	case posbus.SignalWorldDoesNotExist:
+		log.Println("world does not exist signal received")
+	case posbus.SignalDualConnection:
+		log.Println("dual connection signal received")
+	case posbus.SignalConnected:
+		log.Println("connected signal")
+	case posbus.SignalConnectionClosed:
+		log.Println("connection closed signal")
+	default:
+		log.Printf("Unhandled signal %d\n", sig.Value)
+	}
+}
+
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	log.Printf("Serving metrics on %s/metrics\n", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatalf("metrics: %s", err)
+	}
+}
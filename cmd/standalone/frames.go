@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/momentum-xyz/posbus-client/pbc/capture"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+)
+
+// Decoded message, as JSON.
+type decodedMessage struct {
+	// Only for frames of a capture.
+	Time      string `json:"time,omitempty"`
+	Direction string `json:"direction,omitempty"`
+
+	Type string         `json:"type"`
+	ID   string         `json:"id"`
+	Data posbus.Message `json:"data"`
+}
+
+func runDecode(args []string) {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	format := fs.String("format", "auto", "Format of the input: hex, base64, raw or auto")
+	file := fs.String("file", "", "Read the input from a file ('-' for stdin), can also be a capture file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s decode [flags] [message]\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Decodes a binary message, e.g. copied from the browser devtools, to JSON.\n")
+		fmt.Fprintf(fs.Output(), "Without a message argument or file, it is read from stdin.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var input []byte
+	var err error
+	switch {
+	case *file != "":
+		input, err = readInput(*file)
+	case fs.NArg() > 0:
+		input = []byte(strings.Join(fs.Args(), ""))
+	default:
+		input, err = readInput("-")
+	}
+	if err != nil {
+		log.Fatalf("decode: %s", err)
+	}
+
+	var msgs []decodedMessage
+	if r, err := capture.NewReader(bytes.NewReader(input)); err == nil {
+		msgs, err = decodeCapture(r, func(err error) { log.Printf("decode: skipped %s", err) })
+		if err != nil {
+			log.Fatalf("decode: %s", err)
+		}
+	} else {
+		frame, err := parseFrame(input, *format)
+		if err != nil {
+			log.Fatalf("decode: %s", err)
+		}
+		msg, err := decodeFrame(frame)
+		if err != nil {
+			log.Fatalf("decode: %s", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	for _, msg := range msgs {
+		out, err := json.MarshalIndent(msg, "", "  ")
+		if err != nil {
+			log.Fatalf("decode: %s", err)
+		}
+		fmt.Println(string(out))
+	}
+}
+
+// Messages of a capture, frames that are not a valid message are passed to invalid and skipped.
+func decodeCapture(r *capture.Reader, invalid func(error)) ([]decodedMessage, error) {
+	var msgs []decodedMessage
+	for {
+		f, err := r.Next()
+		if err == io.EOF {
+			return msgs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		msg, err := decodeFrame(f.Data)
+		if err != nil {
+			invalid(fmt.Errorf("frame at %s: %w", f.Time, err))
+			continue
+		}
+		msg.Time = f.Time.String()
+		msg.Direction = f.Direction.String()
+		msgs = append(msgs, msg)
+	}
+}
+
+func decodeFrame(frame []byte) (decodedMessage, error) {
+	if len(frame) < 2*posbus.MsgTypeSize {
+		return decodedMessage{}, fmt.Errorf("too short for a message, %d bytes", len(frame))
+	}
+	msgType := posbus.MessageType(frame)
+	if msgType == 0 {
+		return decodedMessage{}, fmt.Errorf("not a message, header and footer do not match")
+	}
+	msg, err := newMessage(msgType)
+	if err != nil {
+		return decodedMessage{}, err
+	}
+	if err := posbus.DecodeTo(frame, msg); err != nil {
+		return decodedMessage{}, err
+	}
+	return decodedMessage{Type: posbus.MessageNameById(msgType), ID: msgTypeID(msgType), Data: msg}, nil
+}
+
+// Bytes of a single frame, in the given text (or raw) format.
+// Auto detection prefers hex over base64, for the (rare) input that is valid as both,
+// and falls back to raw.
+func parseFrame(input []byte, format string) ([]byte, error) {
+	text := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, string(input))
+	switch format {
+	case "raw":
+		return input, nil
+	case "hex":
+		return hex.DecodeString(strings.TrimPrefix(text, "0x"))
+	case "base64":
+		return decodeBase64(text)
+	case "auto":
+		if b, err := hex.DecodeString(strings.TrimPrefix(text, "0x")); err == nil {
+			return b, nil
+		}
+		if b, err := decodeBase64(text); err == nil {
+			return b, nil
+		}
+		return input, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	var err error
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		var b []byte
+		if b, err = enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, err
+}
+
+func runEncode(args []string) {
+	fs := flag.NewFlagSet("encode", flag.ExitOnError)
+	format := fs.String("format", "hex", "Format of the output: hex, base64 or raw")
+	file := fs.String("file", "", "Read the JSON from a file ('-' for stdin)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s encode [flags] [type] [json]\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Encodes a JSON message to binary, the type is a name or ID (see the types command).\n")
+		fmt.Fprintf(fs.Output(), "Without a type, the JSON is the output of decode: {\"type\": ..., \"data\": ...}.\n")
+		fmt.Fprintf(fs.Output(), "Without JSON argument or file, it is read from stdin.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	typeArg := ""
+	rest := fs.Args()
+	if len(rest) > 0 && !strings.HasPrefix(strings.TrimSpace(rest[0]), "{") {
+		typeArg, rest = rest[0], rest[1:]
+	}
+	var input []byte
+	var err error
+	switch {
+	case *file != "":
+		input, err = readInput(*file)
+	case len(rest) > 0:
+		input = []byte(strings.Join(rest, " "))
+	case typeArg == "":
+		input, err = readInput("-")
+	default:
+		// Just a type, an empty message.
+		input = []byte("{}")
+	}
+	if err != nil {
+		log.Fatalf("encode: %s", err)
+	}
+
+	msg, err := encodeMessage(typeArg, input)
+	if err != nil {
+		log.Fatalf("encode: %s", err)
+	}
+	frame := posbus.BinMessage(msg)
+	switch *format {
+	case "hex":
+		fmt.Println(hex.EncodeToString(frame))
+	case "base64":
+		fmt.Println(base64.StdEncoding.EncodeToString(frame))
+	case "raw":
+		os.Stdout.Write(frame)
+	default:
+		log.Fatalf("encode: unknown format %q", *format)
+	}
+}
+
+// Message from JSON, with the type given or else from the JSON itself.
+func encodeMessage(typeArg string, input []byte) (posbus.Message, error) {
+	data := input
+	if typeArg == "" {
+		var envelope struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(input, &envelope); err != nil {
+			return nil, err
+		}
+		if envelope.Type == "" {
+			return nil, fmt.Errorf("no message type given")
+		}
+		typeArg, data = envelope.Type, envelope.Data
+	}
+	msgType, err := parseMsgType(typeArg)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := newMessage(msgType)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		// Catch typos in field names.
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(msg); err != nil {
+			return nil, fmt.Errorf("%s: %w", posbus.MessageNameById(msgType), err)
+		}
+	}
+	return msg, nil
+}
+
+// Message type by name (e.g. set_world) or ID (e.g. 0xCCDF2E49).
+func parseMsgType(s string) (posbus.MsgType, error) {
+	if id := posbus.MessageIdByName(s); id != 0 {
+		return id, nil
+	}
+	if id, err := strconv.ParseUint(s, 0, 32); err == nil && posbus.MessageDataTypeById(posbus.MsgType(id)) != nil {
+		return posbus.MsgType(id), nil
+	}
+	return 0, fmt.Errorf("unknown message type %q", s)
+}
+
+// Like posbus.NewMessageOfType, which panics on unknown types.
+func newMessage(msgType posbus.MsgType) (posbus.Message, error) {
+	if posbus.MessageDataTypeById(msgType) == nil {
+		return nil, fmt.Errorf("unknown message type %s", msgTypeID(msgType))
+	}
+	return posbus.NewMessageOfType(msgType)
+}
+
+func msgTypeID(msgType posbus.MsgType) string {
+	return fmt.Sprintf("0x%08X", uint32(msgType))
+}
+
+// Message type with its fields, by their JSON names.
+type messageSchema struct {
+	Name   string        `json:"name"`
+	ID     string        `json:"id"`
+	Type   string        `json:"type"`
+	Fields []fieldSchema `json:"fields"`
+}
+
+type fieldSchema struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Of a nested struct.
+	Fields []fieldSchema `json:"fields,omitempty"`
+}
+
+func runTypes(args []string) {
+	fs := flag.NewFlagSet("types", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Output as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s types [flags] [type...]\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Lists the message types and their fields, all or the ones given (by name or ID).\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	ids := posbus.GetMessageIds()
+	if fs.NArg() > 0 {
+		ids = nil
+		for _, arg := range fs.Args() {
+			id, err := parseMsgType(arg)
+			if err != nil {
+				log.Fatalf("types: %s", err)
+			}
+			ids = append(ids, id)
+		}
+	}
+	schemas := make([]messageSchema, 0, len(ids))
+	for _, id := range ids {
+		t := posbus.MessageDataTypeById(id)
+		schemas = append(schemas, messageSchema{
+			Name:   posbus.MessageNameById(id),
+			ID:     msgTypeID(id),
+			Type:   t.String(),
+			Fields: structFields(t, map[reflect.Type]bool{}),
+		})
+	}
+
+	if *asJSON {
+		out, err := json.MarshalIndent(schemas, "", "  ")
+		if err != nil {
+			log.Fatalf("types: %s", err)
+		}
+		fmt.Println(string(out))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, s := range schemas {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Name, s.ID, s.Type)
+		printFields(w, s.Fields, "  ")
+	}
+	w.Flush()
+}
+
+func printFields(w io.Writer, fields []fieldSchema, indent string) {
+	for _, f := range fields {
+		fmt.Fprintf(w, "%s%s\t%s\t\n", indent, f.Name, f.Type)
+		printFields(w, f.Fields, indent+"  ")
+	}
+}
+
+var (
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Fields of a struct as encoded by encoding/json, nil for other types.
+// Nested structs are included, unless they encode themselves (e.g. IDs) or are already being described.
+func structFields(t reflect.Type, seen map[reflect.Type]bool) []fieldSchema {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		if t.Implements(jsonMarshaler) || t.Implements(textMarshaler) {
+			return nil
+		}
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] ||
+		reflect.PointerTo(t).Implements(jsonMarshaler) || reflect.PointerTo(t).Implements(textMarshaler) {
+		return nil
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	var fields []fieldSchema
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, structFields(f.Type, seen)...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, fieldSchema{Name: name, Type: f.Type.String(), Fields: structFields(f.Type, seen)})
+	}
+	return fields
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
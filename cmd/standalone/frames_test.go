@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/momentum-xyz/posbus-client/pbc/capture"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Frame with a valid header and footer, around the given body.
+func rawFrame(msgType posbus.MsgType, body []byte) []byte {
+	frame := binary.LittleEndian.AppendUint32(nil, uint32(msgType))
+	frame = append(frame, body...)
+	return binary.LittleEndian.AppendUint32(frame, uint32(^msgType))
+}
+
+func TestParseFrame(t *testing.T) {
+	frame := posbus.BinMessage(&posbus.SetWorld{Name: "test"})
+	hexed := hex.EncodeToString(frame)
+	for _, tc := range []struct {
+		name, input, format string
+		want                []byte
+		err                 bool
+	}{
+		{"hex", hexed, "hex", frame, false},
+		{"hex with prefix and spaces", "0x" + hexed[:8] + " \n" + hexed[8:], "hex", frame, false},
+		{"base64", base64.StdEncoding.EncodeToString(frame), "base64", frame, false},
+		{"base64 url without padding", base64.RawURLEncoding.EncodeToString(frame), "base64", frame, false},
+		{"raw", "not a frame", "raw", []byte("not a frame"), false},
+		{"auto hex", hexed, "auto", frame, false},
+		{"auto base64", base64.StdEncoding.EncodeToString(frame), "auto", frame, false},
+		{"auto raw", "not a frame!", "auto", []byte("not a frame!"), false},
+		{"invalid hex", "xyz", "hex", nil, true},
+		{"invalid base64", "!!", "base64", nil, true},
+		{"unknown format", hexed, "binary", nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseFrame([]byte(tc.input), tc.format)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseMsgType(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  posbus.MsgType
+		err   bool
+	}{
+		{"set_world", posbus.TypeSetWorld, false},
+		{msgTypeID(posbus.TypeSetWorld), posbus.TypeSetWorld, false},
+		{"no_such_type", 0, true},
+		{"0x12345678", 0, true},
+		{"", 0, true},
+	} {
+		got, err := parseMsgType(tc.input)
+		if tc.err {
+			assert.Error(t, err, tc.input)
+			continue
+		}
+		require.NoError(t, err, tc.input)
+		assert.Equal(t, tc.want, got, tc.input)
+	}
+}
+
+func TestEncodeMessage(t *testing.T) {
+	id := umid.New()
+	for _, tc := range []struct {
+		name, typeArg, input string
+		want                 posbus.Message
+		err                  bool
+	}{
+		{"type given", "set_world", `{"name": "test"}`, &posbus.SetWorld{Name: "test"}, false},
+		{"type by ID", msgTypeID(posbus.TypeSetWorld), `{"name": "test"}`, &posbus.SetWorld{Name: "test"}, false},
+		{"envelope", "", `{"type": "teleport_request", "data": {"target": "` + id.String() + `"}}`, &posbus.TeleportRequest{Target: id}, false},
+		{"envelope without data", "", `{"type": "high_five"}`, &posbus.HighFive{}, false},
+		{"envelope without type", "", `{"data": {}}`, nil, true},
+		{"invalid JSON", "set_world", `{"name":`, nil, true},
+		{"unknown field", "set_world", `{"nmae": "test"}`, nil, true},
+		{"unknown type", "no_such_type", `{}`, nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := encodeMessage(tc.typeArg, []byte(tc.input))
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		frame []byte
+		want  posbus.Message
+		err   string
+	}{
+		{"valid", posbus.BinMessage(&posbus.SetWorld{Name: "test"}), &posbus.SetWorld{Name: "test"}, ""},
+		{"too short", []byte{1, 2, 3}, nil, "too short"},
+		{"header and footer differ", []byte{1, 0, 0, 0, 1, 0, 0, 0}, nil, "not a message"},
+		{"unknown type", rawFrame(posbus.MsgType(0x12345678), nil), nil, "unknown message type 0x12345678"},
+		{"truncated body", rawFrame(posbus.TypeSetWorld, []byte{200}), nil, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := decodeFrame(tc.frame)
+			if tc.want == nil {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "set_world", got.Type)
+			assert.Equal(t, msgTypeID(posbus.TypeSetWorld), got.ID)
+			assert.Equal(t, tc.want, got.Data)
+		})
+	}
+}
+
+func TestDecodeCapture(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := capture.NewWriter(&buf)
+	require.NoError(t, err)
+	require.NoError(t, w.Record(capture.Outbound, posbus.BinMessage(&posbus.HighFive{})))
+	require.NoError(t, w.Record(capture.Inbound, []byte{1, 2, 3}))
+	require.NoError(t, w.Record(capture.Inbound, rawFrame(posbus.MsgType(0x12345678), nil)))
+	require.NoError(t, w.Record(capture.Inbound, posbus.BinMessage(&posbus.SetWorld{Name: "test"})))
+	require.NoError(t, w.Flush())
+	data := buf.Bytes()
+
+	r, err := capture.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	var invalid []error
+	msgs, err := decodeCapture(r, func(err error) { invalid = append(invalid, err) })
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "high_five", msgs[0].Type)
+	assert.Equal(t, "out", msgs[0].Direction)
+	assert.Equal(t, "set_world", msgs[1].Type)
+	assert.Equal(t, "in", msgs[1].Direction)
+	assert.Len(t, invalid, 2)
+
+	// A capture cut off in the middle of a frame.
+	r, err = capture.NewReader(bytes.NewReader(data[:len(data)-3]))
+	require.NoError(t, err)
+	_, err = decodeCapture(r, func(error) {})
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/momentum-xyz/posbus-client/test/scenarios"
+	"github.com/momentum-xyz/ubercontroller/logger"
+	"go.uber.org/zap/zapcore"
+)
+
+// Run a load test plan, see scenarios.Plan for the format.
+func runLoad(args []string) {
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	backendArg := fs.String("backend", "http://localhost:4000", "The URL to the controller backend")
+	logLevel := fs.String("log", "warn", "Log level (warn, info, debug")
+	jsonReport := fs.String("json", "", "Write the report as JSON to this file")
+	csvReport := fs.String("csv", "", "Write the metrics per user as CSV to this file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s load [flags] <plan file>\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Runs a load test of guest users, as described in a YAML or JSON plan.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	backend, err := url.Parse(*backendArg)
+	if err != nil {
+		log.Fatalf("Invalid backend URL %s", err)
+	}
+	l, err := zapcore.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatalf("Invalid log level %s", err)
+	}
+	logger.SetLevel(l)
+	plan, err := scenarios.LoadPlan(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("load: %s", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	users := 0
+	for _, c := range plan.Cohorts {
+		users += c.Count
+	}
+	log.Printf("Running %d users in %d cohorts\n", users, len(plan.Cohorts))
+	runner := &scenarios.Runner{Backend: backend, Metrics: scenarios.NewMetrics(), Logger: logger.L().Desugar()}
+	if err := runner.Run(ctx, plan); err != nil {
+		log.Fatalf("load: %s", err)
+	}
+
+	report := runner.Metrics.Report()
+	fmt.Println()
+	report.WriteTable(os.Stdout)
+	writeReport(*jsonReport, report.WriteJSON)
+	writeReport(*csvReport, report.WriteCSV)
+}
+
+func writeReport(path string, write func(io.Writer) error) {
+	if path == "" {
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		log.Printf("report: %s\n", err)
+		return
+	}
+	defer f.Close()
+	if err := write(f); err != nil {
+		log.Printf("report: %s\n", err)
+	}
+}
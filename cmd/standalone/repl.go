@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/momentum-xyz/posbus-client/pbc"
+	"github.com/momentum-xyz/posbus-client/pbc/state"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+)
+
+// Print the messages of msgLogging.
+var verbose atomic.Bool
+
+// Interactive shell on a connected client.
+type repl struct {
+	client *pbc.Client
+	world  *state.World
+	out    io.Writer
+
+	mu sync.Mutex
+	// Message types to print, nil when not tailing and empty for all types.
+	tail map[posbus.MsgType]bool
+}
+
+type replCommand struct {
+	name  string
+	args  string
+	usage string
+	run   func(r *repl, ctx context.Context, args string) error
+}
+
+var replCommands []replCommand
+
+// Set in init, the help command refers to the list itself.
+func init() {
+	replCommands = []replCommand{
+		{"help", "", "List the commands", (*repl).help},
+		{"teleport", "<world id>", "Teleport to a world", (*repl).teleport},
+		{"send", "<type> [json]", "Send a message, e.g. send high_five {\"receiver_id\": \"...\"}", (*repl).send},
+		{"users", "", "List the users in the world", (*repl).users},
+		{"objects", "[parent id]", "List the objects in the world, or the children of an object", (*repl).objects},
+		{"lock", "<object id>", "Lock an object", (*repl).lock},
+		{"unlock", "<object id>", "Unlock an object", (*repl).unlock},
+		{"tail", "[type...|off]", "Print incoming messages, of all or the given types", (*repl).setTail},
+		{"verbose", "[on|off]", "Toggle the logging of some incoming messages", (*repl).setVerbose},
+		{"state", "", "Show the connection state", (*repl).state},
+		{"quit", "", "Disconnect and exit", nil},
+	}
+}
+
+func newRepl(client *pbc.Client, world *state.World, out io.Writer) *repl {
+	r := &repl{client: client, world: world, out: out}
+	client.OnAny(r.onMessage)
+	return r
+}
+
+// Run reads commands until the input ends, ctx is done or on quit.
+func (r *repl) Run(ctx context.Context, in io.Reader) {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	fmt.Fprintln(r.out, "Type 'help' for the commands.")
+	for {
+		fmt.Fprint(r.out, "> ")
+		var line string
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return
+		case line, ok = <-lines:
+			if !ok {
+				return
+			}
+		}
+		name, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if name == "" {
+			continue
+		}
+		if name == "quit" || name == "exit" {
+			return
+		}
+		if err := r.exec(ctx, name, strings.TrimSpace(args)); err != nil {
+			fmt.Fprintf(r.out, "error: %s\n", err)
+		}
+	}
+}
+
+func (r *repl) exec(ctx context.Context, name, args string) error {
+	for _, cmd := range replCommands {
+		if cmd.name == name && cmd.run != nil {
+			return cmd.run(r, ctx, args)
+		}
+	}
+	return fmt.Errorf("unknown command %q, try help", name)
+}
+
+func (r *repl) help(ctx context.Context, args string) error {
+	for _, cmd := range replCommands {
+		fmt.Fprintf(r.out, "  %-30s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.usage)
+	}
+	return nil
+}
+
+func (r *repl) teleport(ctx context.Context, args string) error {
+	world, err := umid.Parse(args)
+	if err != nil {
+		return err
+	}
+	summary, err := r.client.Teleport(ctx, world)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(r.out, "In world %s (%s): %d objects, %d users, loaded in %s\n",
+		summary.Name, summary.ID, summary.Objects, summary.Users, summary.LoadTime)
+	return nil
+}
+
+func (r *repl) send(ctx context.Context, args string) error {
+	typeArg, data, _ := strings.Cut(args, " ")
+	if typeArg == "" {
+		return fmt.Errorf("no message type given")
+	}
+	if strings.TrimSpace(data) == "" {
+		data = "{}"
+	}
+	msg, err := encodeMessage(typeArg, []byte(data))
+	if err != nil {
+		return err
+	}
+	return r.client.SendMessage(ctx, msg)
+}
+
+func (r *repl) users(ctx context.Context, args string) error {
+	users := r.world.Users()
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	for _, u := range users {
+		p := u.Transform.Position
+		fmt.Fprintf(r.out, "  %s  %-20s (%.1f, %.1f, %.1f)\n", u.ID, u.Name, p.X, p.Y, p.Z)
+	}
+	fmt.Fprintf(r.out, "%d users\n", len(users))
+	return nil
+}
+
+func (r *repl) objects(ctx context.Context, args string) error {
+	var objects []state.Object
+	if args != "" {
+		parent, err := umid.Parse(args)
+		if err != nil {
+			return err
+		}
+		objects = r.world.Children(parent)
+	} else {
+		objects = r.world.Objects()
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	for _, o := range objects {
+		p := o.Transform.Position
+		fmt.Fprintf(r.out, "  %s  %-20s parent %s (%.1f, %.1f, %.1f)\n", o.ID, o.Name, o.ParentID, p.X, p.Y, p.Z)
+	}
+	fmt.Fprintf(r.out, "%d objects\n", len(objects))
+	return nil
+}
+
+func (r *repl) lock(ctx context.Context, args string) error {
+	id, err := umid.Parse(args)
+	if err != nil {
+		return err
+	}
+	result, err := r.client.LockObject(ctx, id)
+	if err != nil {
+		return err
+	}
+	if result.Locked {
+		fmt.Fprintln(r.out, "Locked")
+	} else {
+		fmt.Fprintf(r.out, "Locked by %s\n", result.Owner)
+	}
+	return nil
+}
+
+func (r *repl) unlock(ctx context.Context, args string) error {
+	id, err := umid.Parse(args)
+	if err != nil {
+		return err
+	}
+	if err := r.client.UnlockObject(ctx, id); err != nil {
+		return err
+	}
+	fmt.Fprintln(r.out, "Unlocked")
+	return nil
+}
+
+func (r *repl) setTail(ctx context.Context, args string) error {
+	if args == "off" {
+		r.mu.Lock()
+		r.tail = nil
+		r.mu.Unlock()
+		return nil
+	}
+	tail := make(map[posbus.MsgType]bool)
+	for _, name := range strings.Fields(args) {
+		t, err := parseMsgType(name)
+		if err != nil {
+			return err
+		}
+		tail[t] = true
+	}
+	r.mu.Lock()
+	r.tail = tail
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *repl) onMessage(msg posbus.Message) {
+	r.mu.Lock()
+	tail := r.tail
+	r.mu.Unlock()
+	if tail == nil || (len(tail) > 0 && !tail[msg.GetType()]) {
+		return
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		data = []byte(err.Error())
+	}
+	fmt.Fprintf(r.out, "%s %s\n", posbus.MessageNameById(msg.GetType()), data)
+}
+
+func (r *repl) setVerbose(ctx context.Context, args string) error {
+	switch args {
+	case "":
+		verbose.Store(!verbose.Load())
+	case "on":
+		verbose.Store(true)
+	case "off":
+		verbose.Store(false)
+	default:
+		return fmt.Errorf("expected on or off")
+	}
+	fmt.Fprintf(r.out, "Verbose %t\n", verbose.Load())
+	return nil
+}
+
+func (r *repl) state(ctx context.Context, args string) error {
+	fmt.Fprintf(r.out, "%s, in world %s\n", r.client.State(), r.world.Info().ID)
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/momentum-xyz/posbus-client/pbc"
+	"github.com/momentum-xyz/posbus-client/pbc/pbctest"
+	"github.com/momentum-xyz/posbus-client/pbc/state"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Output of the shell, written by the commands and the tail of incoming messages.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRepl(t *testing.T) {
+	ctx := context.Background()
+	self, other := umid.New(), umid.New()
+	world := posbus.SetWorld{ID: umid.New(), Name: "gaia"}
+	parent := posbus.ObjectDefinition{ID: umid.New(), ParentID: world.ID, Name: "island"}
+	child := posbus.ObjectDefinition{ID: umid.New(), ParentID: parent.ID, Name: "tree"}
+	srv := pbctest.NewServer(t)
+	srv.Handle(posbus.TypeTeleportRequest, func(c *pbctest.Conn, msg posbus.Message) {
+		if msg.(*posbus.TeleportRequest).Target != world.ID {
+			c.Send(&posbus.Signal{Value: posbus.SignalWorldDoesNotExist})
+			return
+		}
+		c.SendWorld(world, []posbus.ObjectDefinition{parent, child},
+			[]posbus.UserData{{ID: self, Name: "me"}, {ID: other, Name: "visitor"}})
+	})
+
+	client := pbc.NewClient(pbc.WithTransport(srv.Transport()))
+	client.SetCallback(nil)
+	w := state.New(self)
+	client.OnAny(w.Handle)
+	require.NoError(t, client.Connect(ctx, srv.URL, "token", self))
+	defer client.Close()
+	conn := srv.NextConn()
+
+	script := []string{
+		"help",
+		"",
+		"bogus",
+		"teleport not-an-id",
+		"teleport " + world.ID.String(),
+		"users",
+		"objects",
+		"objects " + parent.ID.String(),
+		fmt.Sprintf(`send high_five {"receiver_id": "%s", "message": "hi"}`, other),
+		"send no_such_type",
+		"send set_world {\"nmae\": \"typo\"}",
+		"tail no_such_type",
+		"tail set_world",
+		"teleport " + world.ID.String(),
+		"tail off",
+		"teleport " + world.ID.String(),
+		"verbose maybe",
+		"state",
+		"quit",
+		"send high_five {}",
+	}
+	var out syncBuffer
+	newRepl(client, w, &out).Run(ctx, strings.NewReader(strings.Join(script, "\n")))
+	output := out.String()
+
+	for _, want := range []string{
+		"teleport <world id>",
+		`error: unknown command "bogus", try help`,
+		"In world gaia (" + world.ID.String() + "): 2 objects, 2 users",
+		"2 users\n",
+		other.String() + "  visitor",
+		"2 objects\n",
+		child.ID.String() + "  tree",
+		"1 objects\n",
+		`error: unknown message type "no_such_type"`,
+		`unknown field "nmae"`,
+		"error: expected on or off",
+		"connected, in world " + world.ID.String(),
+	} {
+		assert.Contains(t, output, want)
+	}
+	assert.Equal(t, 1, strings.Count(output, `set_world {"id":"`+world.ID.String()), "tailed only while on")
+	assert.Equal(t, 3, strings.Count(output, "In world gaia"))
+
+	teleport := pbctest.Expect[*posbus.TeleportRequest](conn)
+	assert.Equal(t, world.ID, teleport.Target)
+	h5 := pbctest.Expect[*posbus.HighFive](conn)
+	assert.Equal(t, other, h5.ReceiverID)
+	assert.Equal(t, "hi", h5.Message)
+	pbctest.Expect[*posbus.TeleportRequest](conn)
+	pbctest.Expect[*posbus.TeleportRequest](conn)
+}
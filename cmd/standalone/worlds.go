@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"text/tabwriter"
+
+	"github.com/momentum-xyz/posbus-client/pbc/api"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+)
+
+// List the worlds of the controller, to find one to connect to.
+func runWorlds(args []string) {
+	fs := flag.NewFlagSet("worlds", flag.ExitOnError)
+	backendArg := fs.String("backend", "http://localhost:4000", "The URL to the controller backend")
+	token := fs.String("token", "", "An authentication token (default is a new guest)")
+	search := fs.String("search", "", "Only the worlds with a name matching this")
+	limit := fs.Int("limit", 20, "Maximum number of worlds, newest first")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s worlds [flags] [world id...]\n\n", os.Args[0])
+		fmt.Fprintf(fs.Output(), "Lists the worlds of the controller, or the details of the ones given.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	backend, err := url.Parse(*backendArg)
+	if err != nil {
+		log.Fatalf("Invalid backend URL %s", err)
+	}
+
+	ctx := context.Background()
+	backendAPI := api.NewClient(backend, api.WithToken(*token))
+	if *token == "" {
+		if _, err := backendAPI.GuestToken(ctx); err != nil {
+			log.Fatalf("guest user: %s", err)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	switch {
+	case fs.NArg() > 0:
+		fmt.Fprintln(w, "ID\tNAME\tOWNER\tCREATED\tONLINE")
+		for _, arg := range fs.Args() {
+			id, err := umid.Parse(arg)
+			if err != nil {
+				log.Fatalf("Invalid world %s", err)
+			}
+			world, err := backendAPI.World(ctx, id)
+			if err != nil {
+				log.Fatalf("worlds: %s", err)
+			}
+			users, err := backendAPI.OnlineUsers(ctx, id)
+			if err != nil {
+				log.Fatalf("worlds: %s", err)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", world.ID, str(world.Name), str(world.OwnerName), world.CreatedAt, len(users))
+		}
+	case *search != "":
+		worlds, err := backendAPI.SearchWorlds(ctx, *search)
+		if err != nil {
+			log.Fatalf("worlds: %s", err)
+		}
+		fmt.Fprintln(w, "ID\tNAME\tDESCRIPTION")
+		for _, world := range worlds {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", world.ID, str(world.Name), str(world.Description))
+		}
+	default:
+		worlds, err := backendAPI.Worlds(ctx, api.Newest, *limit)
+		if err != nil {
+			log.Fatalf("worlds: %s", err)
+		}
+		fmt.Fprintln(w, "ID\tNAME\tOWNER")
+		for _, world := range worlds {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", world.ID, str(world.Name), str(world.OwnerName))
+		}
+	}
+}
+
+func str(s *string) string {
+	if s == nil {
+		return "-"
+	}
+	return *s
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/momentum-xyz/ubercontroller/utils"
 	"github.com/momentum-xyz/ubercontroller/utils/umid"
 	"github.com/pkg/errors"
+	"go.uber.org/zap/zapcore"
 )
 
 var (
@@ -40,6 +41,7 @@ func main() {
 	namespace.Set("connect", js.FuncOf(Connect))
 	namespace.Set("disconnect", js.FuncOf(Disconnect))
 	namespace.Set("teleport", js.FuncOf(Teleport))
+	namespace.Set("setLogLevel", js.FuncOf(SetLogLevel))
 	<-workerCtx.Done()
 	logger.L().Debug("Worker done")
 }
@@ -83,17 +85,48 @@ func Connect(this js.Value, args []js.Value) any {
 	return jsPromise.New(handler)
 }
 
+// Teleport returns a Promise, resolved with a summary of the world once it is loaded.
 func Teleport(this js.Value, args []js.Value) any {
 	if len(args) < 1 {
 		logger.L().Debugf("%+v\n", "PB Teleport: too few arguments")
-		return nil
+		return promiseReject(errors.New("too few arguments"))
 	}
 	world, err := umid.Parse(args[0].String())
 	if err != nil {
-		logger.L().Error("invalid world ID %s", err)
+		logger.L().Debugf("invalid world ID %s", err)
+		return promiseReject(errors.Wrap(err, "world"))
+	}
+	handler := promiseValueExecutor(
+		func() (any, error) {
+			summary, err := client.Teleport(workerCtx, world)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]any{
+				"id":           summary.ID.String(),
+				"name":         summary.Name,
+				"owner":        summary.Owner.String(),
+				"objects":      summary.Objects,
+				"users":        summary.Users,
+				"load_time_ms": summary.LoadTime.Milliseconds(),
+			}, nil
+		},
+	)
+	return jsPromise.New(handler)
+}
+
+// SetLogLevel of the client of the worker: debug, info, warn or error.
+func SetLogLevel(this js.Value, args []js.Value) any {
+	if len(args) < 1 {
+		logger.L().Debugf("%+v\n", "PB SetLogLevel: too few arguments")
+		return nil
+	}
+	level, err := zapcore.ParseLevel(args[0].String())
+	if err != nil {
+		logger.L().Warnf("PB SetLogLevel: %s", err)
 		return nil
 	}
-	go client.Send(posbus.BinMessage(&posbus.TeleportRequest{Target: world}))
+	client.SetLogLevel(level)
 	return nil
 }
 
@@ -110,33 +143,36 @@ func Disconnect(this js.Value, args []js.Value) interface{} {
 func Send(this js.Value, args []js.Value) interface{} {
 	if len(args) < 2 {
 		logger.L().Debugf("%+v\n", "PB Send: too few arguments")
-		return nil
+		return promiseReject(errors.New("too few arguments"))
 	}
 	msgId := posbus.MessageIdByName(args[0].String())
 	if msgId == 0 {
 		logger.L().Debugf("%+v\n", "PB Send: unknown message name")
-		return nil
+		return promiseReject(errors.Errorf("unknown message name %s", args[0].String()))
 	}
 	dataString := []byte(args[1].String())
 
 	msg, err := posbus.NewMessageOfType(msgId)
 	if err != nil {
 		logger.L().Debugf("PB Send: cant Allocate message variable with type  : %+v\n", msgId)
-		return nil
+		return promiseReject(err)
 	}
 	err = json.Unmarshal(dataString, msg)
 	if err != nil {
 		logger.L().Debugf("PB Send: cant unmarshal JSON : %+v\n", string(dataString))
-		return nil
+		return promiseReject(errors.Wrap(err, "unmarshal"))
 	}
 
-	err = client.Send(posbus.BinMessage(msg))
-	if err != nil {
-		logger.L().Debugf("PB Send: %v\n", err)
-		return nil
-	}
-
-	return nil
+	handler := promiseExecutor(
+		func() error {
+			err := client.SendMessage(workerCtx, msg)
+			if err != nil {
+				logger.L().Debugf("PB Send: %v\n", err)
+			}
+			return err
+		},
+	)
+	return jsPromise.New(handler)
 }
 
 // TODO: replace with below method using mapdecode
@@ -191,6 +227,14 @@ func SetPort(this js.Value, args []js.Value) any {
 
 // Helper to run a goroutine as a javascript Promise executor.
 func promiseExecutor(f func() error) js.Func {
+	return promiseValueExecutor(func() (any, error) {
+		return nil, f()
+	})
+}
+
+// Helper to run a goroutine as a javascript Promise executor, resolving with its result.
+// The result must be convertable with js.ValueOf.
+func promiseValueExecutor(f func() (any, error)) js.Func {
 	var jsHandler js.Func
 	jsHandler = js.FuncOf(
 		func(this js.Value, args []js.Value) any {
@@ -202,11 +246,16 @@ func promiseExecutor(f func() error) js.Func {
 			reject := args[1]
 			go func() {
 				defer jsHandler.Release()
-				if err := f(); err != nil {
-					reject.Invoke(err) // hmm, are errors transferable?
+				v, err := f()
+				if err != nil {
+					reject.Invoke(err.Error()) // errors are not transferable, only their message
+					return
+				}
+				if v == nil {
+					resolve.Invoke()
 					return
 				}
-				resolve.Invoke()
+				resolve.Invoke(v)
 			}()
 			return nil
 		},
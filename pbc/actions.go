@@ -0,0 +1,64 @@
+package pbc
+
+import (
+	"context"
+	"math"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/cmath"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/pkg/errors"
+)
+
+// Invalid input for an action, the message is not send.
+var ErrInvalidArgument = errors.New("PBC: invalid argument")
+
+// Move the user of the client to a new position in the current world.
+func (c *Client) Move(ctx context.Context, transform cmath.TransformNoScale) error {
+	if !validVec3(transform.Position) || !validVec3(transform.Rotation) {
+		return errors.Wrapf(ErrInvalidArgument, "move to %+v", transform)
+	}
+	t := posbus.MyTransform(transform)
+	return c.SendMessage(ctx, &t)
+}
+
+// HighFive another user, from the user of the client.
+func (c *Client) HighFive(ctx context.Context, userID umid.UMID, text string) error {
+	self := c.userID()
+	if userID == umid.Nil || userID == self {
+		return errors.Wrapf(ErrInvalidArgument, "high five user %s", userID)
+	}
+	return c.SendMessage(ctx, &posbus.HighFive{
+		SenderID:   self,
+		ReceiverID: userID,
+		Message:    text,
+	})
+}
+
+// SetObjectTransform changes the position, rotation and scale of an object.
+// The object should be locked by this client.
+func (c *Client) SetObjectTransform(ctx context.Context, objectID umid.UMID, transform cmath.Transform) error {
+	if objectID == umid.Nil {
+		return errors.Wrap(ErrInvalidArgument, "transform nil object")
+	}
+	if !validVec3(transform.Position) || !validVec3(transform.Rotation) || !validVec3(transform.Scale) {
+		return errors.Wrapf(ErrInvalidArgument, "object transform %+v", transform)
+	}
+	return c.SendMessage(ctx, &posbus.ObjectTransform{ID: objectID, Transform: transform})
+}
+
+// ID of the user of the client, as used in the handshake.
+func (c *Client) userID() umid.UMID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hs.UserId
+}
+
+func validVec3(v cmath.Vec3) bool {
+	for _, f := range [...]float32{v.X, v.Y, v.Z} {
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			return false
+		}
+	}
+	return true
+}
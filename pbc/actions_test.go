@@ -0,0 +1,25 @@
+package pbc
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/cmath"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActionValidation(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient()
+	nan := float32(math.NaN())
+
+	assert.ErrorIs(t, c.Move(ctx, cmath.TransformNoScale{Position: cmath.Vec3{X: nan}}), ErrInvalidArgument)
+	assert.ErrorIs(t, c.HighFive(ctx, umid.Nil, "hi"), ErrInvalidArgument)
+	assert.ErrorIs(t, c.SetObjectTransform(ctx, umid.New(), cmath.Transform{Scale: cmath.Vec3{Z: nan}}), ErrInvalidArgument)
+
+	// Valid, but not connected.
+	assert.ErrorIs(t, c.Move(ctx, cmath.TransformNoScale{}), ErrNotConnected)
+	assert.ErrorIs(t, c.HighFive(ctx, umid.New(), "hi"), ErrNotConnected)
+}
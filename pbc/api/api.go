@@ -0,0 +1,175 @@
+// Package api calls the HTTP endpoints of the controller that a posbus client needs:
+// getting a token (as guest or with a signed challenge), the user profile and finding worlds.
+//
+//	backend := api.NewClient(backendURL)
+//	user, err := backend.GuestToken(ctx)
+//	worlds, err := backend.Worlds(ctx, api.Newest, 10)
+//	client := pbc.NewClient()
+//	err = client.Connect(ctx, backend.PosbusURL(), backend.Token(), user.ID)
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Version of the controller API.
+const apiPath = "/api/v4"
+
+// Error response of the controller.
+type Error struct {
+	// HTTP status code.
+	StatusCode int
+	// Short machine readable reason, e.g. invalid_request_query.
+	Reason string
+	// Description of the error.
+	Message string
+
+	method, path string
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = e.Reason
+	}
+	return fmt.Sprintf("PBC: api: %s %s: %d %s: %s", e.method, e.path, e.StatusCode, http.StatusText(e.StatusCode), msg)
+}
+
+// ErrNoToken is returned for calls that need an authenticated user, before there is a token.
+var ErrNoToken = errors.New("PBC: api: no token")
+
+// Client of the controller API, safe for concurrent use.
+// The token from GuestToken or Login is used for the calls that need an authenticated user.
+type Client struct {
+	backend *url.URL
+	http    *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+// Option to configure a Client, see NewClient.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client to do the requests with, e.g. one that retries.
+// Default is http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithToken sets the token of an already authenticated user.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// NewClient for the controller at backend, e.g. http://localhost:4000.
+func NewClient(backend *url.URL, opts ...Option) *Client {
+	c := &Client{backend: backend, http: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// PosbusURL returns the websocket URL of the controller to connect a pbc.Client to.
+func (c *Client) PosbusURL() string {
+	u := *c.backend.JoinPath("posbus")
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	return u.String()
+}
+
+// Token returns the current token, empty when not authenticated.
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// SetToken changes the token used for the calls that need an authenticated user.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// Do a request and decode the JSON response into out (when not nil).
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any, auth bool) error {
+	u := c.backend.JoinPath(apiPath, path)
+	u.RawQuery = query.Encode()
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return errors.WithMessagef(err, "PBC: api: %s %s", method, path)
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return errors.WithMessagef(err, "PBC: api: %s %s", method, path)
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if auth {
+		token := c.Token()
+		if token == "" {
+			return errors.Wrapf(ErrNoToken, "%s %s", method, path)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errors.WithMessagef(err, "PBC: api: %s %s", method, path)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return responseError(resp, method, path)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.WithMessagef(err, "PBC: api: %s %s: decode response", method, path)
+	}
+	return nil
+}
+
+// The controller responds with {"error": {"reason": ..., "message": ...}}, or plain text from a proxy in between.
+func responseError(resp *http.Response, method, path string) error {
+	e := &Error{StatusCode: resp.StatusCode, method: method, path: path}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var payload struct {
+		Error struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(b, &payload) == nil && (payload.Error.Reason != "" || payload.Error.Message != "") {
+		e.Reason, e.Message = payload.Error.Reason, payload.Error.Message
+	} else {
+		e.Message = strings.TrimSpace(string(b))
+	}
+	return e
+}
@@ -0,0 +1,150 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/momentum-xyz/posbus-client/pbc/api"
+	"github.com/momentum-xyz/ubercontroller/universe/logic/api/dto"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Fake of the controller endpoints.
+func backend(t *testing.T) (*api.Client, umid.UMID) {
+	userID := umid.New()
+	worldID := umid.New()
+	name := "Gaia"
+	token := "guest-token"
+
+	verified := func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer "+token {
+				writeJSON(w, http.StatusUnauthorized, map[string]any{"error": map[string]string{"reason": "invalid_token", "message": "not verified"}})
+				return
+			}
+			h(w, r)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/auth/guest-token", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		writeJSON(w, http.StatusOK, dto.User{ID: userID, Name: "Visitor_1", JWTToken: &token, IsGuest: true})
+	})
+	mux.HandleFunc("/api/v4/auth/challenge", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"challenge": "sign " + r.URL.Query().Get("wallet")})
+	})
+	mux.HandleFunc("/api/v4/auth/token", func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			Wallet, Network, SignedChallenge string
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+		if in.SignedChallenge != "signed: sign "+in.Wallet {
+			writeJSON(w, http.StatusForbidden, map[string]any{"error": map[string]string{"reason": "invalid_signature"}})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"token": token})
+	})
+	mux.HandleFunc("/api/v4/users/me", verified(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, dto.User{ID: userID, Name: "Visitor_1"})
+	}))
+	mux.HandleFunc("/api/v4/worlds", verified(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, url.Values{"sort": {"ASC"}, "limit": {"1"}}, r.URL.Query())
+		writeJSON(w, http.StatusOK, []dto.RecentWorld{{ID: worldID, Name: &name}})
+	}))
+	mux.HandleFunc("/api/v4/worlds/explore/search", verified(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gai", r.URL.Query().Get("query"))
+		writeJSON(w, http.StatusOK, dto.SearchOptions{{ID: worldID, Name: &name}})
+	}))
+	mux.HandleFunc("/api/v4/worlds/"+worldID.String(), verified(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, dto.WorldDetails{ID: worldID, Name: &name, OwnerID: userID})
+	}))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	return api.NewClient(u), worldID
+}
+
+func TestGuestToken(t *testing.T) {
+	ctx := context.Background()
+	c, worldID := backend(t)
+
+	_, err := c.Me(ctx)
+	require.ErrorIs(t, err, api.ErrNoToken)
+
+	user, err := c.GuestToken(ctx)
+	require.NoError(t, err)
+	assert.True(t, user.IsGuest)
+	assert.Equal(t, "guest-token", c.Token())
+
+	me, err := c.Me(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, me.ID)
+
+	worlds, err := c.Worlds(ctx, api.Oldest, 1)
+	require.NoError(t, err)
+	require.Len(t, worlds, 1)
+	assert.Equal(t, worldID, worlds[0].ID)
+
+	found, err := c.SearchWorlds(ctx, "gai")
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "Gaia", *found[0].Name)
+
+	world, err := c.World(ctx, worldID)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, world.OwnerID)
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	c, _ := backend(t)
+
+	challenge, err := c.Challenge(ctx, "0xabc")
+	require.NoError(t, err)
+	assert.Equal(t, "sign 0xabc", challenge)
+
+	_, err = c.Login(ctx, "0xabc", api.Ethereum, "forged")
+	var apiErr *api.Error
+	require.True(t, errors.As(err, &apiErr), err)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	assert.Equal(t, "invalid_signature", apiErr.Reason)
+	assert.Empty(t, c.Token())
+
+	token, err := c.Login(ctx, "0xabc", api.Ethereum, "signed: "+challenge)
+	require.NoError(t, err)
+	assert.Equal(t, token, c.Token())
+	_, err = c.Me(ctx)
+	require.NoError(t, err)
+
+	c.SetToken("expired")
+	_, err = c.Me(ctx)
+	require.True(t, errors.As(err, &apiErr), err)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Contains(t, err.Error(), "GET /users/me: 401 Unauthorized: not verified")
+}
+
+func TestPosbusURL(t *testing.T) {
+	for backend, want := range map[string]string{
+		"http://localhost:4000":         "ws://localhost:4000/posbus",
+		"https://demo.momentum.xyz/":    "wss://demo.momentum.xyz/posbus",
+		"https://example.com/momentum/": "wss://example.com/momentum/posbus",
+	} {
+		u, err := url.Parse(backend)
+		require.NoError(t, err)
+		assert.Equal(t, want, api.NewClient(u).PosbusURL(), backend)
+	}
+}
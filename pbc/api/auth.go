@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/momentum-xyz/ubercontroller/universe/logic/api/dto"
+	"github.com/pkg/errors"
+)
+
+// Network of a wallet, determines how the signature of a challenge is verified.
+type Network string
+
+const (
+	Polkadot Network = "polkadot"
+	Ethereum Network = "ethereum"
+)
+
+// GuestToken creates a new guest user, and uses its token from now on.
+func (c *Client) GuestToken(ctx context.Context) (*dto.User, error) {
+	var user dto.User
+	if err := c.do(ctx, http.MethodPost, "/auth/guest-token", nil, nil, &user, false); err != nil {
+		return nil, err
+	}
+	if user.JWTToken == nil || *user.JWTToken == "" {
+		return nil, errors.New("PBC: api: guest token: no token in response")
+	}
+	c.SetToken(*user.JWTToken)
+	return &user, nil
+}
+
+// Challenge returns a challenge for the wallet to sign, for Login.
+func (c *Client) Challenge(ctx context.Context, wallet string) (string, error) {
+	var out struct {
+		Challenge string `json:"challenge"`
+	}
+	q := url.Values{"wallet": {wallet}}
+	if err := c.do(ctx, http.MethodGet, "/auth/challenge", q, nil, &out, false); err != nil {
+		return "", err
+	}
+	return out.Challenge, nil
+}
+
+// Login with the challenge of the wallet signed by it, and use the token from now on.
+// The user is created when the wallet is not known yet.
+func (c *Client) Login(ctx context.Context, wallet string, network Network, signedChallenge string) (string, error) {
+	in := struct {
+		Wallet          string  `json:"wallet"`
+		Network         Network `json:"network,omitempty"`
+		SignedChallenge string  `json:"signedChallenge"`
+	}{wallet, network, signedChallenge}
+	var out struct {
+		Token string `json:"token"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/auth/token", nil, in, &out, false); err != nil {
+		return "", err
+	}
+	c.SetToken(out.Token)
+	return out.Token, nil
+}
+
+// Me returns the user of the token.
+func (c *Client) Me(ctx context.Context) (*dto.User, error) {
+	var user dto.User
+	if err := c.do(ctx, http.MethodGet, "/users/me", nil, nil, &user, true); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
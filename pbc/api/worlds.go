@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/momentum-xyz/ubercontroller/universe/logic/api/dto"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+)
+
+// Order of the worlds by creation time, see Worlds.
+type Order string
+
+const (
+	Newest Order = "DESC"
+	Oldest Order = "ASC"
+)
+
+// Worlds lists (at most limit) worlds, limit 0 is the default of the controller (100).
+func (c *Client) Worlds(ctx context.Context, order Order, limit int) ([]dto.RecentWorld, error) {
+	q := url.Values{}
+	if order != "" {
+		q.Set("sort", string(order))
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var worlds []dto.RecentWorld
+	if err := c.do(ctx, http.MethodGet, "/worlds", q, nil, &worlds, true); err != nil {
+		return nil, err
+	}
+	return worlds, nil
+}
+
+// SearchWorlds returns the worlds with a name that matches the query.
+func (c *Client) SearchWorlds(ctx context.Context, query string) (dto.SearchOptions, error) {
+	var worlds dto.SearchOptions
+	if err := c.do(ctx, http.MethodGet, "/worlds/explore/search", url.Values{"query": {query}}, nil, &worlds, true); err != nil {
+		return nil, err
+	}
+	return worlds, nil
+}
+
+// World returns the details of a world.
+func (c *Client) World(ctx context.Context, worldID umid.UMID) (*dto.WorldDetails, error) {
+	var world dto.WorldDetails
+	if err := c.do(ctx, http.MethodGet, "/worlds/"+worldID.String(), nil, nil, &world, true); err != nil {
+		return nil, err
+	}
+	return &world, nil
+}
+
+// OnlineUsers returns the users that are in a world.
+func (c *Client) OnlineUsers(ctx context.Context, worldID umid.UMID) ([]dto.User, error) {
+	var users []dto.User
+	if err := c.do(ctx, http.MethodGet, "/worlds/"+worldID.String()+"/online-users", nil, nil, &users, true); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
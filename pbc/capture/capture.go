@@ -0,0 +1,230 @@
+// Package capture reads and writes recordings of the frames of a posbus connection.
+//
+// A capture file starts with a header (magic, version and the start time),
+// followed by a record per frame: direction, time since the start and the (binary posbus) message.
+// Numbers are unsigned varints.
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	magic   = "PBCAP"
+	version = 1
+	// Sanity limit on the size of a frame when reading.
+	maxFrameSize = 64 << 20
+)
+
+// Direction of a frame, seen from the client.
+type Direction uint8
+
+const (
+	// From the server to the client.
+	Inbound Direction = iota
+	// From the client to the server.
+	Outbound
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Inbound:
+		return "in"
+	case Outbound:
+		return "out"
+	default:
+		return "unknown"
+	}
+}
+
+// Frame is a single recorded message.
+type Frame struct {
+	// Time since the start of the recording.
+	Time      time.Duration
+	Direction Direction
+	// Binary encoded posbus message.
+	Data []byte
+}
+
+// ErrInvalidFormat is returned when reading something that is not a (supported) capture.
+var ErrInvalidFormat = errors.New("capture: invalid format")
+
+// Writer records frames, safe to use from multiple goroutines.
+type Writer struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+	start  time.Time
+	buf    [binary.MaxVarintLen64]byte
+}
+
+// NewWriter starts a recording, writing the header to w.
+func NewWriter(w io.Writer) (*Writer, error) {
+	cw := &Writer{w: bufio.NewWriter(w), start: time.Now()}
+	if c, ok := w.(io.Closer); ok {
+		cw.closer = c
+	}
+	if _, err := cw.w.WriteString(magic); err != nil {
+		return nil, err
+	}
+	cw.w.WriteByte(version)
+	cw.writeUvarint(uint64(cw.start.UnixNano()))
+	return cw, cw.w.Flush()
+}
+
+// Create a capture file.
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Record a frame, timestamped with the time since the start of the recording.
+// Frames recorded concurrently are written in the order of their timestamps.
+func (w *Writer) Record(dir Direction, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// Monotonic clock, not affected by changes of the wall clock.
+	return w.writeFrame(Frame{Time: time.Since(w.start), Direction: dir, Data: data})
+}
+
+// WriteFrame writes a frame as is.
+func (w *Writer) WriteFrame(f Frame) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.writeFrame(f)
+}
+
+// Caller must hold the lock.
+func (w *Writer) writeFrame(f Frame) error {
+	w.w.WriteByte(byte(f.Direction))
+	w.writeUvarint(uint64(f.Time))
+	w.writeUvarint(uint64(len(f.Data)))
+	_, err := w.w.Write(f.Data)
+	return err
+}
+
+// Caller must hold the lock.
+func (w *Writer) writeUvarint(v uint64) {
+	n := binary.PutUvarint(w.buf[:], v)
+	w.w.Write(w.buf[:n])
+}
+
+// Flush buffered frames to the underlying writer.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Flush()
+}
+
+// Close flushes the frames, and closes the underlying writer if it is a Closer.
+func (w *Writer) Close() error {
+	err := w.Flush()
+	if w.closer != nil {
+		if cerr := w.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Reader reads a recording.
+type Reader struct {
+	// Wall clock time the recording started.
+	Start  time.Time
+	r      *bufio.Reader
+	closer io.Closer
+}
+
+// NewReader starts reading a recording, reading the header from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	cr := &Reader{r: bufio.NewReader(r)}
+	if c, ok := r.(io.Closer); ok {
+		cr.closer = c
+	}
+	head := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(cr.r, head); err != nil {
+		return nil, errors.Wrap(ErrInvalidFormat, err.Error())
+	}
+	if string(head[:len(magic)]) != magic {
+		return nil, ErrInvalidFormat
+	}
+	if head[len(magic)] != version {
+		return nil, errors.Wrapf(ErrInvalidFormat, "version %d", head[len(magic)])
+	}
+	start, err := binary.ReadUvarint(cr.r)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidFormat, err.Error())
+	}
+	cr.Start = time.Unix(0, int64(start))
+	return cr, nil
+}
+
+// Open a capture file.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Next reads the next frame.
+// Returns io.EOF at the end of the recording.
+func (r *Reader) Next() (Frame, error) {
+	dir, err := r.r.ReadByte()
+	if err != nil {
+		return Frame{}, err
+	}
+	t, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return Frame{}, unexpectedEOF(err)
+	}
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return Frame{}, unexpectedEOF(err)
+	}
+	if size > maxFrameSize {
+		return Frame{}, errors.Wrapf(ErrInvalidFormat, "frame of %d bytes", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return Frame{}, unexpectedEOF(err)
+	}
+	return Frame{Time: time.Duration(t), Direction: Direction(dir), Data: data}, nil
+}
+
+// Close the underlying reader, if it is a Closer.
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// A recording that ends halfway a frame.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
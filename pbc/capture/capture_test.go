@@ -0,0 +1,89 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	require.NoError(t, err)
+	frames := []Frame{
+		{Time: 0, Direction: Outbound, Data: []byte("handshake")},
+		{Time: 5 * time.Millisecond, Direction: Inbound, Data: []byte("world")},
+		{Time: time.Hour, Direction: Inbound, Data: []byte{}},
+	}
+	for _, f := range frames {
+		require.NoError(t, w.WriteFrame(f))
+	}
+	require.NoError(t, w.Record(Outbound, []byte("recorded")))
+	require.NoError(t, w.Close())
+
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), r.Start, time.Minute)
+	for _, expected := range frames {
+		f, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, expected, f)
+	}
+	f, err := r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "recorded", string(f.Data))
+	assert.Equal(t, Outbound, f.Direction)
+	_, err = r.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestCaptureInvalid(t *testing.T) {
+	_, err := NewReader(bytes.NewReader([]byte("not a capture")))
+	assert.ErrorIs(t, err, ErrInvalidFormat)
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	require.NoError(t, err)
+	require.NoError(t, w.Record(Inbound, []byte("truncated")))
+	require.NoError(t, w.Flush())
+	r, err := NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-3]))
+	require.NoError(t, err)
+	_, err = r.Next()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestCaptureConcurrentOrder(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	for _, dir := range []Direction{Inbound, Outbound, Inbound, Outbound} {
+		wg.Add(1)
+		go func(dir Direction) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				w.Record(dir, []byte("frame"))
+			}
+		}(dir)
+	}
+	wg.Wait()
+	require.NoError(t, w.Flush())
+
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	var last time.Duration
+	for {
+		f, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, f.Time, last, "out of order")
+		last = f.Time
+	}
+}
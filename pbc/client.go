@@ -2,14 +2,21 @@ package pbc
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/momentum-xyz/posbus-client/pbc/capture"
+	"github.com/momentum-xyz/posbus-client/pbc/internal/listeners"
 	"github.com/momentum-xyz/ubercontroller/logger"
 	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
 	"github.com/momentum-xyz/ubercontroller/utils/umid"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
-	"nhooyr.io/websocket"
 )
 
 const (
@@ -27,25 +34,67 @@ const (
 )
 
 type Client struct {
-	conn          *websocket.Conn
-	log           *zap.SugaredLogger
-	url           string
-	hs            posbus.HandShake
-	currentTarget umid.UMID
-	callback      func(data posbus.Message)
-	clientCtx     context.Context
-	connectionCtx context.Context
-	cancelConn    context.CancelFunc
-}
-
-func NewClient() *Client {
+	mu                 sync.Mutex
+	transport          Transport
+	recorder           Recorder
+	metrics            MetricsHook
+	tracer             trace.Tracer
+	conn               Conn
+	log                *zap.SugaredLogger
+	logCtx             logContext
+	url                string
+	hs                 posbus.HandShake
+	callback           atomic.Pointer[func(data posbus.Message)]
+	handlers           handlers
+	pending            pendingRequests
+	dispatchMu         sync.Mutex
+	clientCtx          context.Context
+	connectionCtx      context.Context
+	cancelConn         context.CancelCauseFunc
+	state              stateMachine
+	takenOver          atomic.Bool
+	reconnectPolicy    ReconnectPolicy
+	tokenProvider      TokenProvider
+	tokenTimer         *time.Timer
+	rejectedHandshakes atomic.Int32
+	handshakeTimeout   time.Duration
+	queue              *sendQueue
+	priority           func(posbus.MsgType) Priority
+	pingPeriod         time.Duration
+	pongWait           time.Duration
+	rtt                atomic.Int64
+	session            *session
+	resumeListeners    listeners.List[Resume]
+	lostAt             time.Time
+	closeReason        string
+	connectSpan        trace.SpanContext
+	generation         uint64
+}
+
+func NewClient(opts ...Option) *Client {
 	c := &Client{}
 	c.log = logger.L()
-	c.callback = c.defaultCallback
+	c.logCtx.level = zap.NewAtomicLevel()
+	c.SetCallback(c.defaultCallback)
+	c.session = newSession()
+	c.transport = WebsocketTransport{ReadLimit: inMessageSizeLimit}
+	c.reconnectPolicy = DefaultReconnectPolicy()
+	c.queue = newSendQueue(maxBufferSize, OverflowDisconnect)
+	c.priority = DefaultPriority
+	c.pingPeriod = pingPeriod
+	c.pongWait = pongWait
+	c.handshakeTimeout = handshakeTimeout
+	c.metrics = NopMetrics{}
+	c.tracer = otel.GetTracerProvider().Tracer(tracerName)
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.log = c.newLogger(c.log.Desugar())
 	return c
 }
 
 func (c *Client) Connect(ctx context.Context, url, token string, userId umid.UMID) error {
+	c.mu.Lock()
 	c.url = url
 	c.hs.Token = token
 	c.hs.UserId = userId
@@ -53,90 +102,324 @@ func (c *Client) Connect(ctx context.Context, url, token string, userId umid.UMI
 	c.hs.HandshakeVersion = 1
 	c.hs.ProtocolVersion = 1
 	c.clientCtx = ctx
-	c.connectionCtx, c.cancelConn = context.WithCancel(ctx)
-	return c.doConnect(c.connectionCtx, false)
+	c.connectionCtx, c.cancelConn = context.WithCancelCause(ctx)
+	connCtx := c.connectionCtx
+	session := c.hs.SessionId
+	c.mu.Unlock()
+	c.logCtx.setConnection(session, userId)
+	c.takenOver.Store(false)
+	c.rejectedHandshakes.Store(0)
+	if token == "" && c.tokenProvider != nil {
+		if err := c.refreshToken(ctx); err != nil {
+			return err
+		}
+	} else {
+		c.scheduleTokenRefresh(token)
+	}
+	return c.doConnect(connCtx, nil)
+}
+
+var (
+	// Send while the client is not connected (and not trying to).
+	ErrNotConnected = errors.New("PBC: not connected")
+	// Writing the message to the connection took too long.
+	ErrWriteTimeout = errors.New("PBC: write timeout")
+	// The connection was closed before the message could be written.
+	ErrConnectionClosed = errors.New("PBC: connection closed")
+)
+
+// Send a (binary encoded) message.
+// The message is queued and written to the connection by the write pump, so it is safe to call from multiple goroutines.
+// Blocks until the message is written, the context is done or it failed.
+// While reconnecting, messages stay queued until there is a new connection.
+func (c *Client) Send(ctx context.Context, msg []byte) error {
+	if len(msg) < posbus.MsgTypeSize*2 {
+		return errors.Errorf("PBC: invalid message of %d bytes", len(msg))
+	}
+	switch c.State() {
+	case StateIdle, StateClosed, StateFailed, StateAuthFailed:
+		return ErrNotConnected
+	}
+	m := newOutMessage(ctx, msg, c.messagePriority(msg))
+	err := c.queue.push(ctx, m)
+	c.metrics.QueueLength(c.queue.length())
+	if errors.Is(err, errQueueOverflow) {
+		c.log.Warn("PBC: send queue overflow, dropping connection")
+		c.dropConnection(err)
+		return ErrQueueFull
+	}
+	if err != nil {
+		return err
+	}
+	select {
+	case err := <-m.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func (c *Client) Send(msg []byte) (err error) {
-	//c.send <- msg
-	if err := c.conn.Write(c.connectionCtx, websocket.MessageBinary, msg); err != nil {
-		c.log.Debugf("write error: %v", err)
+// SendMessage encodes and sends a posbus message, see Send.
+func (c *Client) SendMessage(ctx context.Context, msg posbus.Message) error {
+	if msg == nil {
+		return errors.New("PBC: nil message")
 	}
-	return
+	return c.Send(ctx, posbus.BinMessage(msg))
 }
 
-func (c *Client) doConnect(ctx context.Context, reconnect bool) error {
-	var err error
-	c.log.Infof("PBC: connecting to %s (re:%v)... ", c.url, reconnect)
-	for ok := true; ok; ok = err != nil {
-		conn, _, err := websocket.Dial(ctx, c.url, nil)
-		if err != nil {
-			c.log.Infof("websocker dail: %v", err)
-			time.Sleep(time.Second)
+func (c *Client) messagePriority(msg []byte) Priority {
+	p := c.priority(posbus.MessageType(msg))
+	if p < PriorityLow || p >= numPriorities {
+		return PriorityNormal
+	}
+	return p
+}
+
+// Drop the current connection, the read pump will reconnect.
+func (c *Client) dropConnection(cause error) {
+	c.mu.Lock()
+	cancelConn := c.cancelConn
+	c.mu.Unlock()
+	if cancelConn != nil {
+		cancelConn(cause)
+	}
+}
+
+// Setup the connection.
+// A non-nil lostErr indicates this is a reconnect, for a connection lost because of that error.
+func (c *Client) doConnect(ctx context.Context, lostErr error) error {
+	reconnect := lostErr != nil
+	var span trace.Span
+	spanCtx := ctx
+	if reconnect {
+		// Its own trace, the connect could be long ago.
+		c.mu.Lock()
+		closeReason, connectSpan := c.closeReason, c.connectSpan
+		c.mu.Unlock()
+		spanCtx, span = c.startSpan(ctx, "pbc.reconnect", trace.WithNewRoot(),
+			trace.WithLinks(trace.Link{SpanContext: connectSpan}),
+			trace.WithAttributes(attrCloseReason.String(closeReason), attrCause.String(lostErr.Error())))
+	} else {
+		spanCtx, span = c.startSpan(ctx, "pbc.connect")
+		c.mu.Lock()
+		c.connectSpan = span.SpanContext()
+		c.mu.Unlock()
+		c.setState(StateDialing, nil)
+	}
+	c.log.Infof("PBC: connecting to %s (re:%v)... ", c.serverURL(), reconnect)
+	conn, err := c.dial(spanCtx, lostErr)
+	if err != nil {
+		endSpan(span, err)
+		if ctx.Err() != nil {
+			c.setState(StateClosed, ctx.Err())
+			return errors.WithMessage(err, "PBC: connect")
+		}
+		c.log.Warn(err)
+		if errors.Is(err, ErrAuthFailed) {
+			c.setState(StateAuthFailed, err)
 		} else {
-			c.conn = conn
+			c.setState(StateFailed, err)
 		}
+		c.dispatch(&posbus.Signal{Value: posbus.SignalConnectionFailed})
+		return err
+	}
+	if reconnect && c.State().IsTerminal() {
+		// Closed by the user while we were reconnecting.
+		endSpan(span, ErrConnectionClosed)
+		conn.Close("user")
+		return nil
+	}
+	c.mu.Lock()
+	c.conn = conn
+	cancelConn := c.cancelConn
+	c.generation++
+	generation, lostAt := c.generation, c.lostAt
+	// Copied, the token can be refreshed meanwhile.
+	hs := c.hs
+	c.mu.Unlock()
+	if !reconnect {
+		c.setState(StateHandshaking, nil)
 	}
-	//if err != nil {
-	//c.callback(posbus.TypeSignal, posbus.Signal{Value: posbus.SignalConnectionFailed})
-	//	return err
-	//}
-	c.startIOPumps(ctx, c.cancelConn)
-	c.Send(posbus.BinMessage(&c.hs))
-	c.callback(&posbus.Signal{Value: posbus.SignalConnected})
+	// These go first, before anything that is queued.
+	initial := [][]byte{posbus.BinMessage(&hs)}
 	if reconnect {
-		c.Send(posbus.BinMessage(&posbus.TeleportRequest{Target: c.currentTarget}))
+		resume := c.session.beginResume(generation, lostAt)
+		if len(resume) > 0 {
+			initial = append(initial, resume...)
+			time.AfterFunc(resumeTimeout, func() {
+				c.deliver(c.session.timeoutResume(generation))
+			})
+		}
 	}
+	stats := &connStats{start: time.Now()}
+	go c.readPump(ctx, conn, stats, cancelConn)
+	_, hsSpan := c.startSpan(spanCtx, "pbc.handshake")
+	for _, msg := range initial {
+		if err := c.write(ctx, conn, msg); err != nil {
+			// Let the read pump handle it as a lost connection.
+			c.log.Debugf("PBC: handshake: %v", err)
+			endSpan(hsSpan, err)
+			endSpan(span, err)
+			cancelConn(err)
+			return nil
+		}
+	}
+	hsSpan.End()
+	go c.writePump(ctx, conn, cancelConn)
+	if pinger, ok := conn.(Pinger); ok && c.pingPeriod > 0 {
+		go c.pingPump(ctx, pinger, stats, cancelConn)
+	}
+	c.setState(StateConnected, nil)
+	span.End()
+	c.dispatch(&posbus.Signal{Value: posbus.SignalConnected})
 	return nil
 }
 
+// Dial the server, retrying according to the reconnect policy.
+func (c *Client) dial(ctx context.Context, lostErr error) (Conn, error) {
+	start := time.Now()
+	attempt := 1
+	if lostErr != nil {
+		if err := c.waitRetry(ctx, attempt, start, lostErr); err != nil {
+			return nil, err
+		}
+		attempt++
+	}
+	// A token for the reconnect, the connect itself uses the one given.
+	renewed := lostErr == nil
+	for ; ; attempt++ {
+		c.logCtx.setAttempt(attempt)
+		if !renewed {
+			err := c.renewToken(ctx)
+			if errors.Is(err, ErrAuthFailed) || ctx.Err() != nil {
+				return nil, err
+			}
+			if err != nil {
+				c.log.Infof("PBC: dial: %v", err)
+				if err := c.waitRetry(ctx, attempt, start, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			renewed = true
+		}
+		dctx, span := c.startSpan(ctx, "pbc.dial", trace.WithAttributes(attrAttempt.Int(attempt)))
+		conn, err := c.transport.Dial(dctx, c.serverURL())
+		endSpan(span, err)
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		c.log.Infof("PBC: dial: %v", err)
+		c.metrics.DialError(err)
+		if err := c.waitRetry(ctx, attempt, start, err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// SetToken sets the token for the next handshake, e.g. when reconnecting.
 func (c *Client) SetToken(token string) error {
+	c.mu.Lock()
 	c.hs.Token = token
+	c.mu.Unlock()
+	c.scheduleTokenRefresh(token)
 	return nil
 }
 
+// SetURL sets the URL of the server for the next (re)connect.
 func (c *Client) SetURL(url string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.url = url
 	return nil
 }
 
+// URL of the server to (re)connect to.
+func (c *Client) serverURL() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.url
+}
+
+// SetCallback sets the function that gets called for every incoming message.
+// There is only one callback, see On and OnAny to register multiple handlers.
+// Nil removes the (default, logging) callback.
 func (c *Client) SetCallback(f func(msg posbus.Message)) {
-	c.callback = f
+	if f == nil {
+		c.callback.Store(nil)
+		return
+	}
+	c.callback.Store(&f)
 }
 
-func (c *Client) startIOPumps(ctx context.Context, cf context.CancelFunc) {
-	go c.readPump(ctx, cf)
-	//go c.writePump(ctx, cf)
+// Pass a message to the user of the client.
+// Calls are serialized, since messages come from the read pump and (re)connecting.
+func (c *Client) dispatch(msg posbus.Message) {
+	c.dispatchMu.Lock()
+	defer c.dispatchMu.Unlock()
+	if f := c.callback.Load(); f != nil {
+		(*f)(msg)
+	}
+	c.handlers.emit(msg)
+	c.pending.dispatch(msg)
+}
+
+// Dispatch messages from the session, and the result of resuming it.
+func (c *Client) deliver(msgs []posbus.Message, resumed *Resume) {
+	for _, msg := range msgs {
+		c.dispatch(msg)
+	}
+	if resumed != nil {
+		c.log.Infof("PBC: resumed session in world %s after %s", resumed.World, resumed.Downtime)
+		c.resumeListeners.Emit(*resumed)
+	}
 }
 
 func (c *Client) Close() error {
 	c.log.Infof("PBC: disconnect")
-	return c.conn.Close(websocket.StatusNormalClosure, "")
+	c.setState(StateClosed, nil)
+	c.stopTokenRefresh()
+	c.mu.Lock()
+	conn, cancelConn := c.conn, c.cancelConn
+	c.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+	// Stop the read pump first, it holds the read lock needed for the close handshake.
+	cancelConn(nil)
+	if err := conn.Close(""); err != nil {
+		c.log.Debugf("PBC: close: %v", err)
+	}
+	return nil
 }
 
-func (c *Client) readPump(ctx context.Context, connectionCancel context.CancelFunc) {
+func (c *Client) readPump(ctx context.Context, conn Conn, stats *connStats, connectionCancel context.CancelCauseFunc) {
 	c.log.Infof("PBC: start of read pump")
 
-	c.conn.SetReadLimit(inMessageSizeLimit)
-	//c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	//c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	// Dead connections are detected by the ping pump.
 	closeReason := ""
+	var cause error
 	for {
-		messageType, message, err := c.conn.Read(ctx)
+		message, err := conn.Read(ctx)
+		if errors.Is(err, ErrInvalidFrame) {
+			c.log.Errorf("PBC: read pump: %v", err)
+			c.metrics.DecodeError(err)
+			continue
+		}
 		if err != nil {
-			if ce, ok := err.(*websocket.CloseError); ok {
-				switch ce.Code {
-				case websocket.StatusNormalClosure,
-					websocket.StatusGoingAway,
-					websocket.StatusNoStatusRcvd:
-					c.log.Info(
-						errors.WithMessagef(err, "PBC: read pump: websocket closed by server"),
-					)
-					closeReason = "server"
-				}
-			} else if errors.Is(err, context.Canceled) {
+			cause = err
+			if errors.Is(err, io.EOF) {
+				c.log.Info(
+					errors.WithMessagef(err, "PBC: read pump: connection closed by server"),
+				)
+				closeReason = "server"
+			} else if ctx.Err() != nil {
+				cause = context.Cause(ctx)
 				c.log.Info(
-					errors.WithMessagef(err, "PBC: read pump: cancelled by client"),
+					errors.WithMessagef(cause, "PBC: read pump: cancelled by client"),
 				)
 				closeReason = "user"
 			} else {
@@ -147,25 +430,97 @@ func (c *Client) readPump(ctx context.Context, connectionCancel context.CancelFu
 			}
 			break
 		}
-		if messageType != websocket.MessageBinary {
-			c.log.Errorf("PBC: read pump: wrong incoming message type: %d", messageType)
-		} else {
-			if err := c.processMessage(message); err != nil {
-				c.log.Warn(errors.WithMessage(err, "PBC: read pump: failed to handle message"))
-			}
+		c.record(capture.Inbound, message)
+		stats.received++
+		c.metrics.Message(capture.Inbound, frameType(message), len(message))
+		if err := c.processMessage(message); err != nil {
+			c.log.Warn(errors.WithMessage(err, "PBC: read pump: failed to handle message"))
+			c.metrics.DecodeError(err)
 		}
 	}
-	c.conn.Close(websocket.StatusNormalClosure, closeReason)
-	c.callback(&posbus.Signal{Value: posbus.SignalConnectionClosed})
+	conn.Close(closeReason)
+	c.mu.Lock()
+	c.lostAt = time.Now()
+	c.closeReason = closeReason
+	c.mu.Unlock()
+	c.dispatch(&posbus.Signal{Value: posbus.SignalConnectionClosed})
 	c.log.Infof("PBC: end of read pump")
-	if ctx.Err() == nil { // Only try reconnecting if it was not cancelled by us
-		connectionCancel()                                              //stops the read/write goroutines for (previous) connection
-		c.connectionCtx, c.cancelConn = context.WithCancel(c.clientCtx) // from original client context
-		go c.doConnect(c.connectionCtx, true)
+	switch {
+	case c.clientCtx.Err() != nil || c.State() == StateClosed:
+		// Closed or cancelled by us, no reconnect.
+		connectionCancel(nil)
+		c.setState(StateClosed, cause)
+	case c.takenOver.Load():
+		connectionCancel(ErrDualConnection)
+		c.setState(StateFailed, ErrDualConnection)
+	case c.handshakeRejected(stats, closeReason, cause):
+		connectionCancel(ErrAuthFailed)
+		c.setState(StateAuthFailed, ErrAuthFailed)
+	default:
+		connectionCancel(cause) //stops the read/write goroutines for (previous) connection
+		c.setState(StateReconnecting, cause)
+		c.mu.Lock()
+		c.connectionCtx, c.cancelConn = context.WithCancelCause(c.clientCtx) // from original client context
+		connCtx := c.connectionCtx
+		c.mu.Unlock()
+		go c.doConnect(connCtx, cause)
+	}
+}
+
+func (c *Client) writePump(ctx context.Context, conn Conn, connectionCancel context.CancelCauseFunc) {
+	c.log.Infof("PBC: start of write pump")
+	defer c.log.Infof("PBC: end of write pump")
+	for {
+		m, ok := c.queue.pop(ctx)
+		if !ok {
+			return
+		}
+		c.metrics.QueueLength(c.queue.length())
+		err := c.write(ctx, conn, m.data)
+		if errors.Is(err, ErrConnectionClosed) {
+			// Try again on the next connection.
+			c.queue.requeue(m)
+			if c.State().IsTerminal() {
+				c.queue.fail(ErrConnectionClosed)
+			}
+			c.metrics.QueueLength(c.queue.length())
+		} else {
+			m.result(err)
+		}
+		if err != nil {
+			c.log.Debugf("write error: %v", err)
+			connectionCancel(err)
+			return
+		}
+		c.session.sent(m.data)
+	}
+}
+
+func (c *Client) write(ctx context.Context, conn Conn, msg []byte) error {
+	wctx, cancel := context.WithTimeout(ctx, writeWait)
+	defer cancel()
+	err := conn.Write(wctx, msg)
+	switch {
+	case err == nil:
+		c.record(capture.Outbound, msg)
+		c.metrics.Message(capture.Outbound, frameType(msg), len(msg))
+		return nil
+	case ctx.Err() == nil && errors.Is(wctx.Err(), context.DeadlineExceeded):
+		return ErrWriteTimeout
+	default:
+		return fmt.Errorf("%w: %w", ErrConnectionClosed, err)
 	}
 }
 
 func (c *Client) processMessage(buf []byte) error {
+	// Decode panics on these.
+	msgType := frameType(buf)
+	if msgType == 0 {
+		return errors.Errorf("PBC: read pump: invalid message of %d bytes", len(buf))
+	}
+	if posbus.MessageDataTypeById(msgType) == nil {
+		return errors.Errorf("PBC: read pump: unknown message type %#x", uint32(msgType))
+	}
 	msg, err := posbus.Decode(buf)
 	if err != nil {
 		l := len(buf)
@@ -176,10 +531,15 @@ func (c *Client) processMessage(buf []byte) error {
 		return errors.WithMessagef(err, "PBC: read pump: failed to decode message, head=%#v (total len=%d)", buf[:head], l)
 	}
 
-	if msg.GetType() == posbus.TypeSetWorld {
-		c.currentTarget = msg.(*posbus.SetWorld).ID
+	switch m := msg.(type) {
+	case *posbus.Signal:
+		if m.Value == posbus.SignalDualConnection {
+			c.takenOver.Store(true)
+		}
+	case *posbus.SetWorld:
+		c.logCtx.setWorld(m.ID)
 	}
-	c.callback(msg)
+	c.deliver(c.session.handle(msg, c.userID()))
 	return nil
 }
 
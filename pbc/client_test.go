@@ -0,0 +1,350 @@
+package pbc_test
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/momentum-xyz/posbus-client/pbc"
+	"github.com/momentum-xyz/posbus-client/pbc/capture"
+	"github.com/momentum-xyz/posbus-client/pbc/pbctest"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+)
+
+// Reconnect right away in tests.
+var fastRetry = &pbc.ExponentialBackoff{Initial: time.Millisecond, Max: 10 * time.Millisecond}
+
+// Server with a single world, responding to teleports.
+// Returns a function to change the objects in the world.
+func worldServer(t *testing.T, world posbus.SetWorld, objects []posbus.ObjectDefinition) (*pbctest.Server, func([]posbus.ObjectDefinition)) {
+	var mu sync.Mutex
+	srv := pbctest.NewServer(t)
+	srv.Handle(posbus.TypeTeleportRequest, func(c *pbctest.Conn, msg posbus.Message) {
+		if msg.(*posbus.TeleportRequest).Target != world.ID {
+			c.Send(&posbus.Signal{Value: posbus.SignalWorldDoesNotExist})
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		c.SendWorld(world, objects, []posbus.UserData{{ID: c.Handshake.UserId}})
+	})
+	return srv, func(o []posbus.ObjectDefinition) {
+		mu.Lock()
+		defer mu.Unlock()
+		objects = o
+	}
+}
+
+func connect(t *testing.T, srv *pbctest.Server, transport pbc.Transport) (*pbc.Client, *pbctest.Conn) {
+	t.Helper()
+	c := pbc.NewClient(pbc.WithTransport(transport), pbc.WithReconnectPolicy(fastRetry))
+	c.SetCallback(nil)
+	require.NoError(t, c.Connect(context.Background(), srv.URL, "token", umid.New()))
+	t.Cleanup(func() { c.Close() })
+	return c, srv.NextConn()
+}
+
+func waitState(t *testing.T, c *pbc.Client, state pbc.ConnectionState) {
+	t.Helper()
+	require.Eventually(t, func() bool { return c.State() == state }, pbctest.Timeout, time.Millisecond, "state %s", state)
+}
+
+func TestClientTeleport(t *testing.T) {
+	ctx := context.Background()
+	world := posbus.SetWorld{ID: umid.New(), Name: "test"}
+	srv, _ := worldServer(t, world, make([]posbus.ObjectDefinition, 3))
+	c, conn := connect(t, srv, srv.Transport())
+	assert.Equal(t, "token", conn.Handshake.Token)
+
+	_, err := c.Teleport(ctx, umid.New())
+	assert.ErrorIs(t, err, pbc.ErrWorldDoesNotExist)
+
+	summary, err := c.Teleport(ctx, world.ID)
+	require.NoError(t, err)
+	assert.Equal(t, world, summary.SetWorld)
+	assert.Equal(t, 3, summary.Objects)
+	assert.Equal(t, 1, summary.Users)
+}
+
+func TestClientLock(t *testing.T) {
+	ctx := context.Background()
+	other := umid.New()
+	free, taken := umid.New(), umid.New()
+	srv := pbctest.NewServer(t)
+	srv.Handle(posbus.TypeLockObject, func(c *pbctest.Conn, msg posbus.Message) {
+		id := msg.(*posbus.LockObject).ID
+		if id == taken {
+			c.Send(&posbus.LockObjectResponse{ID: id, Result: 0, LockOwner: other})
+			return
+		}
+		c.Send(&posbus.LockObjectResponse{ID: id, Result: 1, LockOwner: c.Handshake.UserId})
+	})
+	srv.Handle(posbus.TypeUnlockObject, func(c *pbctest.Conn, msg posbus.Message) {
+		c.Send(&posbus.LockObjectResponse{ID: msg.(*posbus.UnlockObject).ID, Result: 1})
+	})
+	c, _ := connect(t, srv, srv.Transport())
+
+	result, err := c.LockObject(ctx, free)
+	require.NoError(t, err)
+	assert.True(t, result.Locked)
+	assert.Equal(t, []umid.UMID{free}, c.HeldLocks())
+
+	result, err = c.LockObject(ctx, taken)
+	require.NoError(t, err)
+	assert.False(t, result.Locked)
+	assert.Equal(t, other, result.Owner)
+
+	require.NoError(t, c.UnlockObject(ctx, free))
+	assert.Empty(t, c.HeldLocks())
+}
+
+func TestClientResume(t *testing.T) {
+	ctx := context.Background()
+	world := posbus.SetWorld{ID: umid.New()}
+	kept, removed, added := umid.New(), umid.New(), umid.New()
+	srv, setObjects := worldServer(t, world, []posbus.ObjectDefinition{{ID: kept}, {ID: removed}})
+	srv.Handle(posbus.TypeLockObject, func(c *pbctest.Conn, msg posbus.Message) {
+		c.Send(&posbus.LockObjectResponse{ID: msg.(*posbus.LockObject).ID, Result: 1, LockOwner: c.Handshake.UserId})
+	})
+	c, conn := connect(t, srv, pbc.WebsocketTransport{})
+	resumed := make(chan pbc.Resume, 1)
+	c.OnResume(func(r pbc.Resume) { resumed <- r })
+	removedObjects := make(chan []umid.UMID, 1)
+	pbc.On(c, func(m *posbus.RemoveObjects) { removedObjects <- m.Objects })
+
+	_, err := c.Teleport(ctx, world.ID)
+	require.NoError(t, err)
+	_, err = c.LockObject(ctx, kept)
+	require.NoError(t, err)
+
+	// Lose the connection, the world changes in the meantime.
+	setObjects([]posbus.ObjectDefinition{{ID: kept}, {ID: added}})
+	conn.Drop()
+	conn = srv.NextConn()
+	pbctest.Expect[*posbus.TeleportRequest](conn)
+	assert.Equal(t, kept, pbctest.Expect[*posbus.LockObject](conn).ID, "lock restored")
+
+	select {
+	case r := <-resumed:
+		assert.Equal(t, world.ID, r.World)
+		assert.Equal(t, []umid.UMID{added}, r.AddedObjects)
+		assert.Equal(t, []umid.UMID{removed}, r.RemovedObjects)
+		assert.Equal(t, []umid.UMID{kept}, r.LocksRestored)
+	case <-time.After(pbctest.Timeout):
+		t.Fatal("not resumed")
+	}
+	select {
+	case ids := <-removedObjects:
+		assert.Equal(t, []umid.UMID{removed}, ids)
+	case <-time.After(pbctest.Timeout):
+		t.Fatal("removed objects not dispatched")
+	}
+	assert.Equal(t, pbc.StateConnected, c.State())
+}
+
+func TestClientDualConnection(t *testing.T) {
+	srv := pbctest.NewServer(t)
+	c, conn := connect(t, srv, pbc.WebsocketTransport{})
+	conn.Send(&posbus.Signal{Value: posbus.SignalDualConnection})
+	conn.CloseWith(websocket.StatusNormalClosure, "dual connection")
+	waitState(t, c, pbc.StateFailed)
+}
+
+func TestClientGiveUp(t *testing.T) {
+	srv := pbctest.NewServer(t)
+	c := pbc.NewClient(pbc.WithReconnectPolicy(&pbc.ExponentialBackoff{Initial: time.Millisecond, MaxAttempts: 2}))
+	c.SetCallback(nil)
+	changes := make(chan pbc.StateChange, 10)
+	c.OnStateChange(func(sc pbc.StateChange) { changes <- sc })
+	require.NoError(t, c.Connect(context.Background(), srv.URL, "token", umid.New()))
+	defer c.Close()
+
+	srv.Refuse(true)
+	srv.NextConn().Drop()
+	waitState(t, c, pbc.StateFailed)
+	var last pbc.StateChange
+	for len(changes) > 0 {
+		last = <-changes
+	}
+	assert.ErrorIs(t, last.Cause, pbc.ErrGaveUp)
+}
+
+func TestClientRecorder(t *testing.T) {
+	ctx := context.Background()
+	world := posbus.SetWorld{ID: umid.New()}
+	srv, _ := worldServer(t, world, nil)
+	var buf bytes.Buffer
+	rec, err := capture.NewWriter(&buf)
+	require.NoError(t, err)
+	c := pbc.NewClient(pbc.WithTransport(srv.Transport()), pbc.WithRecorder(rec))
+	c.SetCallback(nil)
+	require.NoError(t, c.Connect(ctx, srv.URL, "secret", umid.New()))
+	_, err = c.Teleport(ctx, world.ID)
+	require.NoError(t, err)
+	c.Close()
+	require.NoError(t, rec.Flush())
+
+	r, err := capture.NewReader(&buf)
+	require.NoError(t, err)
+	var types []string
+	for {
+		f, err := r.Next()
+		if err != nil {
+			break
+		}
+		msg, err := posbus.Decode(f.Data)
+		require.NoError(t, err)
+		if hs, ok := msg.(*posbus.HandShake); ok {
+			assert.Empty(t, hs.Token, "token not recorded")
+		}
+		types = append(types, f.Direction.String()+" "+posbus.MessageNameById(msg.GetType()))
+	}
+	assert.Equal(t, []string{
+		"out hand_shake", "out teleport_request",
+		"in set_world", "in add_objects", "in add_users", "in users_transform_list",
+	}, types)
+}
+
+func TestClientRTT(t *testing.T) {
+	ctx := context.Background()
+	srv := pbctest.NewServer(t)
+
+	// Over websockets, with pings.
+	c := pbc.NewClient(pbc.WithKeepalive(10*time.Millisecond, pbctest.Timeout))
+	c.SetCallback(nil)
+	require.NoError(t, c.Connect(ctx, srv.URL, "token", umid.New()))
+	defer c.Close()
+	require.Eventually(t, func() bool {
+		rtt, ok := c.RTT()
+		return ok && rtt > 0
+	}, pbctest.Timeout, 5*time.Millisecond)
+
+	// The pipe has no pings.
+	piped := pbc.NewClient(pbc.WithTransport(srv.Transport()), pbc.WithKeepalive(10*time.Millisecond, pbctest.Timeout))
+	piped.SetCallback(nil)
+	require.NoError(t, piped.Connect(ctx, srv.URL, "token", umid.New()))
+	defer piped.Close()
+	time.Sleep(50 * time.Millisecond)
+	_, ok := piped.RTT()
+	assert.False(t, ok)
+}
+
+func TestClientKeepaliveNoTimeout(t *testing.T) {
+	srv := pbctest.NewServer(t)
+	c := pbc.NewClient(pbc.WithKeepalive(10*time.Millisecond, 0))
+	c.SetCallback(nil)
+	require.NoError(t, c.Connect(context.Background(), srv.URL, "token", umid.New()))
+	defer c.Close()
+	changes := stateChanges(c)
+
+	// The default timeout, not dropped on the first ping.
+	time.Sleep(100 * time.Millisecond)
+	_, ok := c.RTT()
+	assert.True(t, ok)
+	assert.Empty(t, changes())
+}
+
+func TestClientStateOrder(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		srv := pbctest.NewServer(t)
+		c, conn := connect(t, srv, srv.Transport())
+		changes := stateChanges(c)
+
+		// Lost and closed at the same time, listeners see one or the other first but never out of order.
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			conn.Drop()
+		}()
+		go func() {
+			defer wg.Done()
+			c.Close()
+		}()
+		wg.Wait()
+		require.Eventually(t, func() bool {
+			all := changes()
+			return len(all) > 0 && all[len(all)-1].To == pbc.StateClosed
+		}, pbctest.Timeout, time.Millisecond)
+		from := pbc.StateConnected
+		for _, sc := range changes() {
+			require.Equal(t, from, sc.From, "%v", changes())
+			from = sc.To
+		}
+	}
+}
+
+func TestClientCloseFromListener(t *testing.T) {
+	srv := pbctest.NewServer(t)
+	c, conn := connect(t, srv, srv.Transport())
+	changes := stateChanges(c)
+	c.OnStateChange(func(sc pbc.StateChange) {
+		if sc.To == pbc.StateReconnecting {
+			c.Close()
+		}
+	})
+	conn.Drop()
+	waitState(t, c, pbc.StateClosed)
+	require.Eventually(t, func() bool { return len(changes()) == 2 }, pbctest.Timeout, time.Millisecond)
+	assert.Equal(t, pbc.StateReconnecting, changes()[0].To)
+	assert.Equal(t, pbc.StateClosed, changes()[1].To)
+}
+
+func TestClientSetURL(t *testing.T) {
+	srv, other := pbctest.NewServer(t), pbctest.NewServer(t)
+	c, conn := connect(t, srv, pbc.WebsocketTransport{})
+
+	// Moved to another server while reconnecting.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn.Drop()
+	}()
+	require.NoError(t, c.SetURL(other.URL))
+	<-done
+	srv.Refuse(true)
+	other.NextConn()
+	waitState(t, c, pbc.StateConnected)
+}
+
+// Counts the messages written, per type.
+type countingMetrics struct {
+	pbc.NopMetrics
+	mu  sync.Mutex
+	out map[posbus.MsgType]int
+}
+
+func (m *countingMetrics) Message(dir capture.Direction, msgType posbus.MsgType, size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if dir == capture.Outbound {
+		m.out[msgType]++
+	}
+}
+
+func (m *countingMetrics) count(msgType posbus.MsgType) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.out[msgType]
+}
+
+func TestClientMetricsHooks(t *testing.T) {
+	ctx := context.Background()
+	srv := pbctest.NewServer(t)
+	hooks := []*countingMetrics{{out: make(map[posbus.MsgType]int)}, {out: make(map[posbus.MsgType]int)}}
+	c := pbc.NewClient(pbc.WithTransport(srv.Transport()), pbc.WithMetrics(hooks[0]), pbc.WithMetrics(hooks[1]))
+	c.SetCallback(nil)
+	require.NoError(t, c.Connect(ctx, srv.URL, "token", umid.New()))
+	defer c.Close()
+	require.NoError(t, c.SendMessage(ctx, &posbus.HighFive{}))
+	for _, h := range hooks {
+		require.Eventually(t, func() bool { return h.count(posbus.TypeHighFive) == 1 }, pbctest.Timeout, time.Millisecond)
+		assert.Equal(t, 1, h.count(posbus.TypeHandShake))
+	}
+}
@@ -0,0 +1,8 @@
+package pbc
+
+import "time"
+
+// SetHandshakeTimeout shortens the time a rejected handshake is closed in, to test a connection that closes after it.
+func SetHandshakeTimeout(c *Client, d time.Duration) {
+	c.handshakeTimeout = d
+}
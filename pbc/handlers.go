@@ -0,0 +1,72 @@
+package pbc
+
+import (
+	"sync"
+
+	"github.com/momentum-xyz/posbus-client/pbc/internal/listeners"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+)
+
+// Registry of message handlers, per message type.
+type handlers struct {
+	mu     sync.Mutex
+	byType map[posbus.MsgType]*listeners.List[posbus.Message]
+	any    listeners.List[posbus.Message]
+}
+
+// On registers a function that gets called for every incoming message of type T.
+// Multiple handlers can be registered for the same type, they are called in order of registration.
+// Returns a function to unsubscribe again.
+//
+// Handlers are called one message at a time, while reading from the connection.
+// So a handler must not wait for another message: calling Teleport, LockObject or UnlockObject
+// from it blocks until their timeout, since the response is only read after the handler returns.
+// Call those in a new goroutine instead.
+//
+//	pbc.On(client, func(m *posbus.SetWorld) { ... })
+func On[T posbus.Message](c *Client, f func(T)) (unsubscribe func()) {
+	var zero T
+	if any(zero) == nil {
+		// T is an interface (posbus.Message) instead of a message type.
+		return c.OnAny(func(msg posbus.Message) {
+			if m, ok := msg.(T); ok {
+				f(m)
+			}
+		})
+	}
+	return c.handlers.forType(zero.GetType()).Add(func(msg posbus.Message) {
+		f(msg.(T))
+	})
+}
+
+// OnAny registers a function that gets called for every incoming message, of any type.
+// Called after the handlers for the specific type, with the same limits as On.
+// Returns a function to unsubscribe again.
+func (c *Client) OnAny(f func(posbus.Message)) (unsubscribe func()) {
+	return c.handlers.any.Add(f)
+}
+
+func (h *handlers) forType(t posbus.MsgType) *listeners.List[posbus.Message] {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.byType == nil {
+		h.byType = make(map[posbus.MsgType]*listeners.List[posbus.Message])
+	}
+	l, ok := h.byType[t]
+	if !ok {
+		l = &listeners.List[posbus.Message]{}
+		h.byType[t] = l
+	}
+	return l
+}
+
+// Call the handlers for a message.
+func (h *handlers) emit(msg posbus.Message) {
+	h.mu.Lock()
+	l := h.byType[msg.GetType()]
+	h.mu.Unlock()
+	if l != nil {
+		l.Emit(msg)
+	}
+	h.any.Emit(msg)
+}
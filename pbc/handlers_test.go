@@ -0,0 +1,30 @@
+package pbc
+
+import (
+	"testing"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlers(t *testing.T) {
+	c := NewClient()
+	c.SetCallback(nil)
+	var got []string
+	unsubscribe := On(c, func(m *posbus.SetWorld) { got = append(got, "world1 "+m.Name) })
+	On(c, func(m *posbus.SetWorld) { got = append(got, "world2 "+m.Name) })
+	On(c, func(m *posbus.AddUsers) { got = append(got, "users") })
+	c.OnAny(func(m posbus.Message) { got = append(got, "any "+posbus.MessageNameById(m.GetType())) })
+	On(c, func(m posbus.Message) { got = append(got, "message") })
+
+	c.dispatch(&posbus.SetWorld{Name: "a"})
+	c.dispatch(&posbus.RemoveUsers{})
+	unsubscribe()
+	c.dispatch(&posbus.SetWorld{Name: "b"})
+
+	assert.Equal(t, []string{
+		"world1 a", "world2 a", "any set_world", "message",
+		"any remove_users", "message",
+		"world2 b", "any set_world", "message",
+	}, got)
+}
@@ -0,0 +1,47 @@
+// Package listeners has the list of callbacks behind the On... and Subscribe functions of the client packages.
+package listeners
+
+import "sync"
+
+// List of registered callback functions, that can be called with a value.
+// The zero value is an empty list, ready to use.
+type List[T any] struct {
+	mu     sync.Mutex
+	nextID uint64
+	fns    []listener[T]
+}
+
+type listener[T any] struct {
+	id uint64
+	fn func(T)
+}
+
+// Add a callback function.
+// Returns a function to remove it again.
+func (l *List[T]) Add(f func(T)) func() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.nextID++
+	id := l.nextID
+	l.fns = append(l.fns, listener[T]{id: id, fn: f})
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i := range l.fns {
+			if l.fns[i].id == id {
+				l.fns = append(l.fns[:i:i], l.fns[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Emit calls all listeners, in order of registration.
+func (l *List[T]) Emit(v T) {
+	l.mu.Lock()
+	fns := l.fns
+	l.mu.Unlock()
+	for _, f := range fns {
+		f.fn(v)
+	}
+}
@@ -0,0 +1,51 @@
+package pbc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// No pong was received in time, the connection is considered dead.
+var ErrPongTimeout = errors.New("PBC: pong timeout")
+
+// RTT returns the round trip time of the last websocket ping, ok is false when it is unknown:
+// not measured yet, or there are no pings (disabled, a transport without them or in the browser).
+func (c *Client) RTT() (rtt time.Duration, ok bool) {
+	rtt = time.Duration(c.rtt.Load())
+	return rtt, rtt > 0
+}
+
+// Periodically ping the server, dropping the connection when it does not answer.
+// Without this a half-open connection (e.g. network gone) would never be noticed.
+func (c *Client) pingPump(ctx context.Context, conn Pinger, stats *connStats, connectionCancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(c.pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pctx, cancel := context.WithTimeout(ctx, c.pongWait)
+		start := time.Now()
+		err := conn.Ping(pctx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.log.Info(errors.WithMessage(err, "PBC: ping"))
+			connectionCancel(fmt.Errorf("%w: %w", ErrPongTimeout, err))
+			return
+		}
+		rtt := time.Since(start)
+		c.rtt.Store(int64(rtt))
+		// Rejected connections are not handled at all, so this one was accepted.
+		stats.ponged.Store(true)
+		c.metrics.PingRTT(rtt)
+		c.log.Debugf("PBC: ping rtt %s", rtt)
+	}
+}
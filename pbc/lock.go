@@ -0,0 +1,88 @@
+package pbc
+
+import (
+	"context"
+	"time"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Time to wait for the response to a lock request.
+// The server does not respond when locking is not allowed (e.g. not an admin of the object).
+const lockTimeout = 10 * time.Second
+
+var (
+	// No response to a lock request, it is not allowed or the object does not exist.
+	ErrLockTimeout = errors.New("PBC: lock timeout")
+	// The object is locked by another user.
+	ErrLockedByOther = errors.New("PBC: object locked by another user")
+)
+
+// LockResult is the response to a lock request.
+type LockResult struct {
+	// Lock granted to this client.
+	Locked bool
+	// User holding the lock.
+	Owner umid.UMID
+}
+
+// LockObject requests a lock on an object, to be able to edit it.
+// Blocks until the server responds. When someone else has the lock, Locked is false and Owner is set to them.
+func (c *Client) LockObject(ctx context.Context, objectID umid.UMID) (*LockResult, error) {
+	if objectID == umid.Nil {
+		return nil, errors.Wrap(ErrInvalidArgument, "lock nil object")
+	}
+	ctx, span := c.startSpan(ctx, "pbc.lock", trace.WithAttributes(attrObjectID.String(objectID.String())))
+	self := c.userID()
+	var result LockResult
+	err := c.request(ctx, &posbus.LockObject{ID: objectID}, lockTimeout, ErrLockTimeout,
+		func(msg posbus.Message) (bool, error) {
+			m, ok := msg.(*posbus.LockObjectResponse)
+			// Without owner it is the response to an unlock.
+			if !ok || m.ID != objectID || m.LockOwner == umid.Nil {
+				return false, nil
+			}
+			result = LockResult{Locked: m.Result == 1 && m.LockOwner == self, Owner: m.LockOwner}
+			return true, nil
+		})
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attribute.Bool("pbc.locked", result.Locked), attribute.String("pbc.lock_owner", result.Owner.String()))
+	span.End()
+	return &result, nil
+}
+
+// UnlockObject releases a lock on an object.
+// Blocks until the server responds, fails with ErrLockedByOther when the lock is held by someone else.
+func (c *Client) UnlockObject(ctx context.Context, objectID umid.UMID) (err error) {
+	if objectID == umid.Nil {
+		return errors.Wrap(ErrInvalidArgument, "unlock nil object")
+	}
+	ctx, span := c.startSpan(ctx, "pbc.unlock", trace.WithAttributes(attrObjectID.String(objectID.String())))
+	defer func() { endSpan(span, err) }()
+	self := c.userID()
+	return c.request(ctx, &posbus.UnlockObject{ID: objectID}, lockTimeout, ErrLockTimeout,
+		func(msg posbus.Message) (bool, error) {
+			m, ok := msg.(*posbus.LockObjectResponse)
+			if !ok || m.ID != objectID {
+				return false, nil
+			}
+			switch {
+			case m.Result == 1 && m.LockOwner == umid.Nil:
+				return true, nil
+			case m.Result == 0 && m.LockOwner != umid.Nil && m.LockOwner != self:
+				return true, errors.Wrapf(ErrLockedByOther, "locked by %s", m.LockOwner)
+			case m.Result == 0:
+				// Was not locked.
+				return true, nil
+			}
+			// Locked by someone else in the meantime.
+			return false, nil
+		})
+}
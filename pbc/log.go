@@ -0,0 +1,158 @@
+package pbc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/exp/slog"
+)
+
+// SetLogLevel changes the log level of the client, regardless of the level of its logger.
+func (c *Client) SetLogLevel(level zapcore.Level) {
+	c.logCtx.level.SetLevel(level)
+	c.logCtx.leveled.Store(true)
+}
+
+// Logger of the client, with its fields and level.
+func (c *Client) newLogger(base *zap.Logger) *zap.SugaredLogger {
+	return base.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return clientCore{Core: core, ctx: &c.logCtx}
+	})).Sugar()
+}
+
+// Fields added to every log line of a client, so the lines of many clients in one process can be told apart.
+type logContext struct {
+	level   zap.AtomicLevel
+	leveled atomic.Bool
+
+	mu      sync.Mutex
+	session umid.UMID
+	user    umid.UMID
+	world   umid.UMID
+	attempt int
+}
+
+func (l *logContext) setConnection(session, user umid.UMID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.session, l.user, l.world, l.attempt = session, user, umid.Nil, 0
+}
+
+func (l *logContext) setWorld(world umid.UMID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.world = world
+}
+
+func (l *logContext) setAttempt(attempt int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.attempt = attempt
+}
+
+func (l *logContext) fields() []zapcore.Field {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fields := make([]zapcore.Field, 0, 4)
+	if l.session != umid.Nil {
+		fields = append(fields, zap.Stringer("session_id", l.session), zap.Stringer("user_id", l.user))
+	}
+	if l.world != umid.Nil {
+		fields = append(fields, zap.Stringer("world_id", l.world))
+	}
+	if l.attempt > 0 {
+		fields = append(fields, zap.Int("attempt", l.attempt))
+	}
+	return fields
+}
+
+// Core of the logger of a client, adds its fields and applies its level (when set).
+type clientCore struct {
+	zapcore.Core
+	ctx *logContext
+}
+
+func (c clientCore) Enabled(level zapcore.Level) bool {
+	if c.ctx.leveled.Load() {
+		return c.ctx.level.Enabled(level)
+	}
+	return c.Core.Enabled(level)
+}
+
+func (c clientCore) With(fields []zapcore.Field) zapcore.Core {
+	return clientCore{Core: c.Core.With(fields), ctx: c.ctx}
+}
+
+func (c clientCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c clientCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, append(fields, c.ctx.fields()...))
+}
+
+// Passes the log entries of zap to a slog.Handler, see WithSlogHandler.
+type slogCore struct {
+	handler slog.Handler
+}
+
+func (c slogCore) Enabled(level zapcore.Level) bool {
+	return c.handler.Enabled(context.Background(), slogLevel(level))
+}
+
+func (c slogCore) With(fields []zapcore.Field) zapcore.Core {
+	return slogCore{handler: c.handler.WithAttrs(slogAttrs(fields))}
+}
+
+func (c slogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c slogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	r := slog.NewRecord(ent.Time, slogLevel(ent.Level), ent.Message, 0)
+	if ent.LoggerName != "" {
+		r.AddAttrs(slog.String("logger", ent.LoggerName))
+	}
+	r.AddAttrs(slogAttrs(fields)...)
+	return c.handler.Handle(context.Background(), r)
+}
+
+func (c slogCore) Sync() error {
+	return nil
+}
+
+func slogLevel(level zapcore.Level) slog.Level {
+	switch {
+	case level <= zapcore.DebugLevel:
+		return slog.LevelDebug
+	case level == zapcore.InfoLevel:
+		return slog.LevelInfo
+	case level == zapcore.WarnLevel:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// Fields as attributes, in the same order.
+func slogAttrs(fields []zapcore.Field) []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		for k, v := range enc.Fields {
+			attrs = append(attrs, slog.Any(k, v))
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,117 @@
+package pbc_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/momentum-xyz/posbus-client/pbc"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/exp/slog"
+)
+
+func TestClientLogger(t *testing.T) {
+	ctx := context.Background()
+	world := posbus.SetWorld{ID: umid.New()}
+	srv, _ := worldServer(t, world, nil)
+	core, logs := observer.New(zapcore.DebugLevel)
+	c := pbc.NewClient(pbc.WithTransport(srv.Transport()), pbc.WithLogger(zap.New(core).Named("bot")), pbc.WithReconnectPolicy(fastRetry))
+	c.SetCallback(nil)
+	userID := umid.New()
+	require.NoError(t, c.Connect(ctx, srv.URL, "token", userID))
+	defer c.Close()
+	conn := srv.NextConn()
+	session := conn.Handshake.SessionId
+	_, err := c.Teleport(ctx, world.ID)
+	require.NoError(t, err)
+
+	entries := logs.FilterMessageSnippet("teleported").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "bot", entries[0].LoggerName)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, session.String(), fields["session_id"])
+	assert.Equal(t, userID.String(), fields["user_id"])
+	assert.Equal(t, world.ID.String(), fields["world_id"])
+	assert.NotContains(t, fields, "attempt", "only while connecting")
+	connected := logs.FilterMessageSnippet("-> connected").All()
+	require.Len(t, connected, 1)
+	assert.EqualValues(t, 1, connected[0].ContextMap()["attempt"])
+
+	// Counted again when reconnecting, and reset once connected.
+	logs.TakeAll()
+	conn.Drop()
+	srv.NextConn()
+	waitState(t, c, pbc.StateConnected)
+	_, err = c.Teleport(ctx, world.ID)
+	require.NoError(t, err)
+	connected = logs.FilterMessageSnippet("-> connected").All()
+	require.Len(t, connected, 1)
+	assert.EqualValues(t, 2, connected[0].ContextMap()["attempt"])
+	entries = logs.FilterMessageSnippet("teleported").All()
+	require.Len(t, entries, 1)
+	assert.NotContains(t, entries[0].ContextMap(), "attempt")
+
+	// Only warnings from now on.
+	c.SetLogLevel(zapcore.WarnLevel)
+	logs.TakeAll()
+	_, err = c.Teleport(ctx, world.ID)
+	require.NoError(t, err)
+	assert.Zero(t, logs.Len())
+}
+
+func TestClientLogLevel(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := worldServer(t, posbus.SetWorld{ID: umid.New()}, nil)
+	core, logs := observer.New(zapcore.WarnLevel)
+	c := pbc.NewClient(pbc.WithTransport(srv.Transport()), pbc.WithLogger(zap.New(core)), pbc.WithLogLevel(zapcore.DebugLevel))
+	c.SetCallback(nil)
+	require.NoError(t, c.Connect(ctx, srv.URL, "token", umid.New()))
+	defer c.Close()
+	assert.NotZero(t, logs.FilterLevelExact(zapcore.DebugLevel).Len())
+}
+
+// Safe for the concurrent writes of the client.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func TestClientSlog(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := worldServer(t, posbus.SetWorld{ID: umid.New()}, nil)
+	var out syncBuffer
+	c := pbc.NewClient(pbc.WithTransport(srv.Transport()),
+		pbc.WithSlogHandler(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	c.SetCallback(nil)
+	userID := umid.New()
+	require.NoError(t, c.Connect(ctx, srv.URL, "token", userID))
+	c.Close()
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	scanner := bufio.NewScanner(&out.buf)
+	lines := 0
+	for scanner.Scan() {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		assert.NotEqual(t, "DEBUG", line["level"])
+		assert.Equal(t, userID.String(), line["user_id"], line["msg"])
+		lines++
+	}
+	assert.NotZero(t, lines)
+}
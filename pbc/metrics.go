@@ -0,0 +1,83 @@
+package pbc
+
+import (
+	"time"
+
+	"github.com/momentum-xyz/posbus-client/pbc/capture"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+)
+
+// MetricsHook receives measurements of a client, see WithMetrics and pbc/pbcprom for a Prometheus collector.
+// Called from the goroutines of the client, so it should be fast and safe for concurrent use.
+// Embed NopMetrics to implement only some of the methods.
+type MetricsHook interface {
+	// A message was received or written, type is 0 when the frame is not a valid message.
+	Message(dir capture.Direction, msgType posbus.MsgType, size int)
+	// A received frame could not be decoded, it is skipped.
+	DecodeError(err error)
+	// Dialing the server failed, it is retried according to the reconnect policy.
+	DialError(err error)
+	// The connection state changed.
+	StateChange(sc StateChange)
+	// The number of messages in the send queue changed.
+	QueueLength(n int)
+	// Round trip time of a websocket ping.
+	PingRTT(rtt time.Duration)
+}
+
+// NopMetrics is a MetricsHook that ignores everything.
+type NopMetrics struct{}
+
+func (NopMetrics) Message(capture.Direction, posbus.MsgType, int) {}
+func (NopMetrics) DecodeError(error)                              {}
+func (NopMetrics) DialError(error)                                {}
+func (NopMetrics) StateChange(StateChange)                        {}
+func (NopMetrics) QueueLength(int)                                {}
+func (NopMetrics) PingRTT(time.Duration)                          {}
+
+// Passes the measurements on to multiple hooks, see WithMetrics.
+type multiMetrics []MetricsHook
+
+func (m multiMetrics) Message(dir capture.Direction, msgType posbus.MsgType, size int) {
+	for _, h := range m {
+		h.Message(dir, msgType, size)
+	}
+}
+
+func (m multiMetrics) DecodeError(err error) {
+	for _, h := range m {
+		h.DecodeError(err)
+	}
+}
+
+func (m multiMetrics) DialError(err error) {
+	for _, h := range m {
+		h.DialError(err)
+	}
+}
+
+func (m multiMetrics) StateChange(sc StateChange) {
+	for _, h := range m {
+		h.StateChange(sc)
+	}
+}
+
+func (m multiMetrics) QueueLength(n int) {
+	for _, h := range m {
+		h.QueueLength(n)
+	}
+}
+
+func (m multiMetrics) PingRTT(rtt time.Duration) {
+	for _, h := range m {
+		h.PingRTT(rtt)
+	}
+}
+
+// Type of a frame, without panicking on short ones.
+func frameType(data []byte) posbus.MsgType {
+	if len(data) < 2*posbus.MsgTypeSize {
+		return 0
+	}
+	return posbus.MessageType(data)
+}
@@ -0,0 +1,125 @@
+package pbc
+
+import (
+	"time"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/exp/slog"
+)
+
+// Option to configure a Client, see NewClient.
+type Option func(*Client)
+
+// WithReconnectPolicy sets the policy to use when (re)connecting fails.
+// Default is DefaultReconnectPolicy.
+func WithReconnectPolicy(p ReconnectPolicy) Option {
+	return func(c *Client) {
+		c.reconnectPolicy = p
+	}
+}
+
+// WithSendQueue sets the maximum number of queued outgoing messages
+// and what to do when sending while the queue is full.
+// Default is a queue of 10000 messages, dropping the connection when full.
+func WithSendQueue(size int, strategy OverflowStrategy) Option {
+	return func(c *Client) {
+		c.queue = newSendQueue(size, strategy)
+	}
+}
+
+// WithMessagePriority sets the function to determine the priority of outgoing messages.
+// Default is DefaultPriority.
+func WithMessagePriority(f func(posbus.MsgType) Priority) Option {
+	return func(c *Client) {
+		c.priority = f
+	}
+}
+
+// WithTransport sets how to connect to the server.
+// Default is a WebsocketTransport.
+func WithTransport(t Transport) Option {
+	return func(c *Client) {
+		c.transport = t
+	}
+}
+
+// WithRecorder records all frames the client sends and receives, e.g. to a capture.Writer.
+// Called from the read and write goroutines, so it should be safe for concurrent use.
+func WithRecorder(r Recorder) Option {
+	return func(c *Client) {
+		c.recorder = r
+	}
+}
+
+// WithMetrics passes measurements of the client to a hook, e.g. a pbcprom.Collector.
+// Can be given more than once, every hook gets all measurements.
+func WithMetrics(h MetricsHook) Option {
+	return func(c *Client) {
+		switch m := c.metrics.(type) {
+		case NopMetrics:
+			c.metrics = h
+		case multiMetrics:
+			c.metrics = append(m[:len(m):len(m)], h)
+		default:
+			c.metrics = multiMetrics{m, h}
+		}
+	}
+}
+
+// WithTracerProvider sets where to send the spans of connecting, teleporting and other requests.
+// Default is the global provider of otel.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *Client) {
+		c.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// WithLogger sets the logger of the client.
+// Default is the logger of the controller packages.
+func WithLogger(l *zap.Logger) Option {
+	return func(c *Client) {
+		c.log = l.Sugar()
+	}
+}
+
+// WithSlogHandler logs to a slog handler, instead of zap.
+func WithSlogHandler(h slog.Handler) Option {
+	return func(c *Client) {
+		c.log = zap.New(slogCore{handler: h}).Sugar()
+	}
+}
+
+// WithLogLevel sets the log level of the client, regardless of the level of its logger.
+// E.g. to debug a single client of many using the same logger, see also SetLogLevel.
+func WithLogLevel(level zapcore.Level) Option {
+	return func(c *Client) {
+		c.SetLogLevel(level)
+	}
+}
+
+// WithTokenProvider sets the function to get a new token, shortly before the current one expires and before reconnecting.
+// Without it an expired token ends the connection with StateAuthFailed.
+// Connect can be called with an empty token, to get the first one from the provider as well.
+func WithTokenProvider(p TokenProvider) Option {
+	return func(c *Client) {
+		c.tokenProvider = p
+	}
+}
+
+// WithKeepalive sets the interval to ping the server
+// and how long to wait for the pong, before the connection is considered lost.
+// A zero interval disables the pings, there are none in the browser (WASM) either.
+// A zero (or negative) timeout is the default of 60s.
+// Default is a ping every 54s and waiting 60s for the pong.
+func WithKeepalive(interval, timeout time.Duration) Option {
+	return func(c *Client) {
+		if timeout <= 0 {
+			timeout = pongWait
+		}
+		c.pingPeriod = interval
+		c.pongWait = timeout
+	}
+}
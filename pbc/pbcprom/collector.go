@@ -0,0 +1,154 @@
+// Package pbcprom exports the metrics of a pbc.Client to Prometheus.
+//
+//	metrics := pbcprom.NewCollector(prometheus.Labels{"bot": "greeter"})
+//	prometheus.MustRegister(metrics)
+//	client := pbc.NewClient(pbc.WithMetrics(metrics))
+package pbcprom
+
+import (
+	"time"
+
+	"github.com/momentum-xyz/posbus-client/pbc"
+	"github.com/momentum-xyz/posbus-client/pbc/capture"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "pbc"
+
+// Collector is a pbc.MetricsHook and a prometheus.Collector.
+// Use one per client, to register the collectors of multiple clients give them different labels.
+type Collector struct {
+	messages     *prometheus.CounterVec
+	bytes        *prometheus.CounterVec
+	decodeErrors prometheus.Counter
+	dialErrors   prometheus.Counter
+	reconnects   prometheus.Counter
+	state        *prometheus.GaugeVec
+	queue        prometheus.Gauge
+	rtt          prometheus.Histogram
+}
+
+var _ pbc.MetricsHook = (*Collector)(nil)
+
+// NewCollector creates the metrics of a client, with the labels added to all of them.
+func NewCollector(labels prometheus.Labels) *Collector {
+	c := &Collector{
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "messages_total",
+			Help:        "Number of posbus messages received (in) and sent (out), by type.",
+			ConstLabels: labels,
+		}, []string{"direction", "type"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "message_bytes_total",
+			Help:        "Size of the posbus messages received (in) and sent (out), by type.",
+			ConstLabels: labels,
+		}, []string{"direction", "type"}),
+		decodeErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "decode_errors_total",
+			Help:        "Number of received frames that could not be decoded.",
+			ConstLabels: labels,
+		}),
+		dialErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "dial_errors_total",
+			Help:        "Number of failed attempts to connect to the server.",
+			ConstLabels: labels,
+		}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "reconnects_total",
+			Help:        "Number of times the connection was lost and the client started reconnecting.",
+			ConstLabels: labels,
+		}),
+		state: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "connection_state",
+			Help:        "Connection state of the client, 1 for the current state.",
+			ConstLabels: labels,
+		}, []string{"state"}),
+		queue: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "send_queue_length",
+			Help:        "Number of messages waiting to be sent.",
+			ConstLabels: labels,
+		}),
+		rtt: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "ping_rtt_seconds",
+			Help:        "Round trip time of the websocket pings.",
+			ConstLabels: labels,
+			Buckets:     []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}),
+	}
+	for s := pbc.StateIdle; s <= pbc.StateAuthFailed; s++ {
+		c.state.WithLabelValues(s.String()).Set(0)
+	}
+	c.state.WithLabelValues(pbc.StateIdle.String()).Set(1)
+	return c
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{c.messages, c.bytes, c.decodeErrors, c.dialErrors, c.reconnects, c.state, c.queue, c.rtt}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.collectors() {
+		m.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c.collectors() {
+		m.Collect(ch)
+	}
+}
+
+// Message implements pbc.MetricsHook.
+func (c *Collector) Message(dir capture.Direction, msgType posbus.MsgType, size int) {
+	direction := "in"
+	if dir == capture.Outbound {
+		direction = "out"
+	}
+	// Unknown types as one, to keep the number of series bounded.
+	name := "invalid"
+	if posbus.MessageDataTypeById(msgType) != nil {
+		name = posbus.MessageNameById(msgType)
+	}
+	c.messages.WithLabelValues(direction, name).Inc()
+	c.bytes.WithLabelValues(direction, name).Add(float64(size))
+}
+
+// DecodeError implements pbc.MetricsHook.
+func (c *Collector) DecodeError(error) {
+	c.decodeErrors.Inc()
+}
+
+// DialError implements pbc.MetricsHook.
+func (c *Collector) DialError(error) {
+	c.dialErrors.Inc()
+}
+
+// StateChange implements pbc.MetricsHook.
+func (c *Collector) StateChange(sc pbc.StateChange) {
+	c.state.WithLabelValues(sc.From.String()).Set(0)
+	c.state.WithLabelValues(sc.To.String()).Set(1)
+	if sc.To == pbc.StateReconnecting {
+		c.reconnects.Inc()
+	}
+}
+
+// QueueLength implements pbc.MetricsHook.
+func (c *Collector) QueueLength(n int) {
+	c.queue.Set(float64(n))
+}
+
+// PingRTT implements pbc.MetricsHook.
+func (c *Collector) PingRTT(rtt time.Duration) {
+	c.rtt.Observe(rtt.Seconds())
+}
@@ -0,0 +1,144 @@
+package pbcprom
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/momentum-xyz/posbus-client/pbc"
+	"github.com/momentum-xyz/posbus-client/pbc/pbctest"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Fails the first dial.
+type flakyTransport struct {
+	pbc.PipeTransport
+	dials atomic.Int32
+}
+
+func (t *flakyTransport) Dial(ctx context.Context, url string) (pbc.Conn, error) {
+	if t.dials.Add(1) == 1 {
+		return nil, errors.New("refused")
+	}
+	return t.PipeTransport.Dial(ctx, url)
+}
+
+func TestCollector(t *testing.T) {
+	ctx := context.Background()
+	unknown := make([]byte, 2*posbus.MsgTypeSize)
+	binary.LittleEndian.PutUint32(unknown, 0x0badf00d)
+	binary.LittleEndian.PutUint32(unknown[posbus.MsgTypeSize:], ^uint32(0x0badf00d))
+
+	var conns atomic.Int32
+	serve := func(conn pbc.Conn) {
+		defer conn.Close("")
+		first := conns.Add(1) == 1
+		for {
+			data, err := conn.Read(ctx)
+			if err != nil {
+				return
+			}
+			switch posbus.MessageType(data) {
+			case posbus.TypeHandShake:
+				if first {
+					conn.Write(ctx, []byte{1, 2, 3})
+					conn.Write(ctx, unknown)
+					conn.Write(ctx, posbus.BinMessage(&posbus.SetWorld{ID: umid.New()}))
+				}
+			case posbus.TypeHighFive:
+				// Drop the connection, the client should come back.
+				return
+			}
+		}
+	}
+
+	metrics := NewCollector(prometheus.Labels{"client": "test"})
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(metrics))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.state.WithLabelValues("idle")))
+
+	c := pbc.NewClient(
+		pbc.WithTransport(&flakyTransport{PipeTransport: pbc.PipeTransport{Serve: serve}}),
+		pbc.WithReconnectPolicy(&pbc.ExponentialBackoff{Initial: time.Millisecond, Max: time.Millisecond}),
+		pbc.WithMetrics(metrics),
+	)
+	c.SetCallback(nil)
+	require.NoError(t, c.Connect(ctx, "pipe", "token", umid.New()))
+	defer c.Close()
+	require.NoError(t, c.SendMessage(ctx, &posbus.HighFive{}))
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.messages.WithLabelValues("out", "hand_shake")) == 2 && c.State() == pbc.StateConnected
+	}, pbctest.Timeout, time.Millisecond)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.dialErrors))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.reconnects))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.decodeErrors))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.messages.WithLabelValues("in", "set_world")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.messages.WithLabelValues("in", "invalid")))
+	assert.Equal(t, 11.0, testutil.ToFloat64(metrics.bytes.WithLabelValues("in", "invalid")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.messages.WithLabelValues("out", "high_five")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.state.WithLabelValues("connected")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.state.WithLabelValues("reconnecting")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.queue))
+
+	metrics.PingRTT(20 * time.Millisecond)
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	names := make(map[string]bool)
+	for _, f := range families {
+		names[f.GetName()] = true
+		for _, m := range f.GetMetric() {
+			require.NotEmpty(t, m.GetLabel())
+			assert.Equal(t, "client", m.GetLabel()[0].GetName())
+		}
+	}
+	assert.True(t, names["pbc_ping_rtt_seconds"])
+	assert.True(t, names["pbc_connection_state"])
+}
+
+// Takes its time to pass on the reconnecting state.
+type slowCollector struct {
+	*Collector
+}
+
+func (c slowCollector) StateChange(sc pbc.StateChange) {
+	if sc.To == pbc.StateReconnecting {
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.Collector.StateChange(sc)
+}
+
+func TestCollectorStateRace(t *testing.T) {
+	srv := pbctest.NewServer(t)
+	metrics := NewCollector(nil)
+	c := pbc.NewClient(
+		pbc.WithTransport(srv.Transport()),
+		pbc.WithReconnectPolicy(&pbc.ExponentialBackoff{Initial: time.Millisecond, Max: time.Millisecond}),
+		pbc.WithMetrics(slowCollector{metrics}),
+	)
+	c.SetCallback(nil)
+	require.NoError(t, c.Connect(context.Background(), srv.URL, "token", umid.New()))
+
+	// Closed while the reconnecting state is still being passed on, the gauge ends up at the last state.
+	srv.NextConn().Drop()
+	require.Eventually(t, func() bool { return c.State() == pbc.StateReconnecting }, pbctest.Timeout, time.Millisecond)
+	c.Close()
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.state.WithLabelValues("closed")) == 1
+	}, pbctest.Timeout, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	for s := pbc.StateIdle; s <= pbc.StateAuthFailed; s++ {
+		if s != pbc.StateClosed {
+			assert.Equal(t, 0.0, testutil.ToFloat64(metrics.state.WithLabelValues(s.String())), s.String())
+		}
+	}
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.state.WithLabelValues("closed")))
+}
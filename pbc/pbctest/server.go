@@ -0,0 +1,386 @@
+// Package pbctest provides a fake posbus server, to test clients without a controller.
+//
+// The server accepts the handshake and then lets the test script the rest:
+// send messages, check what the client sends, respond automatically and drop connections.
+//
+//	srv := pbctest.NewServer(t)
+//	client := pbc.NewClient(pbc.WithTransport(srv.Transport()))
+//	client.Connect(ctx, srv.URL, "token", userID)
+//	conn := srv.NextConn()
+//	conn.Send(&posbus.SetWorld{...})
+//	req := pbctest.Expect[*posbus.TeleportRequest](conn)
+package pbctest
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/momentum-xyz/posbus-client/pbc"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"nhooyr.io/websocket"
+)
+
+// Timeout for waiting on connections and messages.
+var Timeout = 2 * time.Second
+
+// Server is a fake posbus server.
+// It serves websockets on URL, and in-memory connections through Transport.
+type Server struct {
+	// Websocket URL of the server.
+	URL string
+	// Checks the handshake of a new connection, all are accepted when nil.
+	// Like the real server, the connection is closed without a message when rejected.
+	Authenticate func(posbus.HandShake) bool
+
+	t        testing.TB
+	http     *httptest.Server
+	conns    chan *Conn
+	mu       sync.Mutex
+	handlers map[posbus.MsgType][]func(*Conn, posbus.Message)
+	latency  time.Duration
+	refuse   bool
+	closed   bool
+}
+
+// NewServer starts a server, it is closed when the test ends.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		t:        t,
+		conns:    make(chan *Conn, 16),
+		handlers: make(map[posbus.MsgType][]func(*Conn, posbus.Message)),
+	}
+	s.http = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = "ws" + strings.TrimPrefix(s.http.URL, "http") + "/posbus"
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Transport to connect to the server in memory, instead of with websockets.
+func (s *Server) Transport() pbc.Transport {
+	return pbc.PipeTransport{Serve: func(conn pbc.Conn) {
+		s.serve(pipeConn{conn})
+	}}
+}
+
+// Close the server and all its connections.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.http.CloseClientConnections()
+	s.http.Close()
+}
+
+// Handle registers a function that gets called for every message of the type a client sends.
+// For automatic responses, e.g. to a teleport request. Messages are still available to Next.
+func (s *Server) Handle(msgType posbus.MsgType, f func(c *Conn, msg posbus.Message)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[msgType] = append(s.handlers[msgType], f)
+}
+
+// SetLatency delays all messages the server sends.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Refuse new connections, to simulate the server being down.
+// Websocket connections fail with a 503, in-memory connections are closed right away.
+func (s *Server) Refuse(refuse bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refuse = refuse
+}
+
+// NextConn waits for the next connection that passed the handshake.
+// Fails the test when there is none in time.
+func (s *Server) NextConn() *Conn {
+	s.t.Helper()
+	select {
+	case c := <-s.conns:
+		return c
+	case <-time.After(Timeout):
+		s.t.Fatalf("pbctest: no connection within %s", Timeout)
+		return nil
+	}
+}
+
+// Report an error in the test, if it is still running.
+func (s *Server) errorf(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.t.Errorf(format, args...)
+	}
+}
+
+func (s *Server) logf(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.t.Logf(format, args...)
+	}
+}
+
+func (s *Server) refusing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refuse
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.refusing() {
+		http.Error(w, "refused", http.StatusServiceUnavailable)
+		return
+	}
+	hw := &hijackRecorder{ResponseWriter: w}
+	conn, err := websocket.Accept(hw, r, nil)
+	if err != nil {
+		s.logf("pbctest: accept: %v", err)
+		return
+	}
+	s.serve(&wsConn{conn: conn, net: hw.conn})
+}
+
+func (s *Server) serve(tr serverConn) {
+	if s.refusing() {
+		tr.close(websocket.StatusTryAgainLater, "refused")
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer tr.close(websocket.StatusNormalClosure, "")
+
+	data, err := tr.read(ctx)
+	if err != nil {
+		return
+	}
+	msg, err := posbus.Decode(data)
+	hs, ok := msg.(*posbus.HandShake)
+	if err != nil || !ok {
+		s.errorf("pbctest: expected handshake, got %T (%v)", msg, err)
+		return
+	}
+	if s.Authenticate != nil && !s.Authenticate(*hs) {
+		return
+	}
+	c := &Conn{
+		Handshake: *hs,
+		server:    s,
+		tr:        tr,
+		received:  make(chan posbus.Message, 1024),
+		out:       make(chan func(context.Context) error, 1024),
+		done:      make(chan struct{}),
+	}
+	defer close(c.done)
+	go c.writeLoop(ctx)
+	select {
+	case s.conns <- c:
+	default:
+		s.logf("pbctest: connection from %s not picked up", hs.UserId)
+	}
+
+	for {
+		data, err := tr.read(ctx)
+		if err != nil {
+			return
+		}
+		msg, err := posbus.Decode(data)
+		if err != nil {
+			s.errorf("pbctest: decode: %v", err)
+			continue
+		}
+		s.mu.Lock()
+		handlers := s.handlers[msg.GetType()]
+		s.mu.Unlock()
+		for _, f := range handlers {
+			f(c, msg)
+		}
+		select {
+		case c.received <- msg:
+		default:
+			s.errorf("pbctest: too many unread messages, dropping %T", msg)
+		}
+	}
+}
+
+// Conn is a client connection to the server.
+type Conn struct {
+	// Handshake send by the client.
+	Handshake posbus.HandShake
+
+	server   *Server
+	tr       serverConn
+	received chan posbus.Message
+	// Writes (and closing) in order.
+	out  chan func(context.Context) error
+	done chan struct{}
+}
+
+// Send messages to the client, in order.
+func (c *Conn) Send(msgs ...posbus.Message) {
+	for _, msg := range msgs {
+		data := posbus.BinMessage(msg)
+		c.enqueue(func(ctx context.Context) error {
+			return c.tr.write(ctx, data)
+		})
+	}
+}
+
+func (c *Conn) enqueue(f func(context.Context) error) {
+	select {
+	case c.out <- f:
+	case <-c.done:
+	}
+}
+
+// SendWorld sends a world to the client, like the server does after a teleport.
+func (c *Conn) SendWorld(world posbus.SetWorld, objects []posbus.ObjectDefinition, users []posbus.UserData) {
+	transforms := make([]posbus.UserTransform, len(users))
+	for i, u := range users {
+		transforms[i] = posbus.UserTransform{ID: u.ID, Transform: u.Transform}
+	}
+	c.Send(
+		&world,
+		&posbus.AddObjects{Objects: objects},
+		&posbus.AddUsers{Users: users},
+		&posbus.UsersTransformList{Value: transforms},
+	)
+}
+
+// Next returns the next message send by the client.
+// Fails the test when there is none in time.
+func (c *Conn) Next() posbus.Message {
+	c.server.t.Helper()
+	select {
+	case msg := <-c.received:
+		return msg
+	case <-time.After(Timeout):
+		c.server.t.Fatalf("pbctest: no message within %s", Timeout)
+		return nil
+	}
+}
+
+// Expect the next message send by the client to be of type T.
+// Fails the test when it is not, or there is none in time.
+func Expect[T posbus.Message](c *Conn) T {
+	c.server.t.Helper()
+	msg := c.Next()
+	m, ok := msg.(T)
+	if !ok {
+		var expected T
+		c.server.t.Fatalf("pbctest: expected %T, got %T", expected, msg)
+	}
+	return m
+}
+
+// Drop the connection, without closing it properly.
+// Like a network failure, the client only notices when reading or writing fails.
+func (c *Conn) Drop() {
+	c.tr.drop()
+}
+
+// CloseWith closes the connection with a websocket status code, after the messages already send.
+func (c *Conn) CloseWith(code websocket.StatusCode, reason string) {
+	c.enqueue(func(context.Context) error {
+		c.tr.close(code, reason)
+		return nil
+	})
+}
+
+// Done is closed when the connection has ended.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Conn) writeLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case f := <-c.out:
+			c.server.mu.Lock()
+			latency := c.server.latency
+			c.server.mu.Unlock()
+			if latency > 0 {
+				time.Sleep(latency)
+			}
+			if err := f(ctx); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Server end of a connection.
+type serverConn interface {
+	read(ctx context.Context) ([]byte, error)
+	write(ctx context.Context, data []byte) error
+	close(code websocket.StatusCode, reason string)
+	drop()
+}
+
+type wsConn struct {
+	conn *websocket.Conn
+	net  net.Conn
+}
+
+func (c *wsConn) read(ctx context.Context) ([]byte, error) {
+	_, data, err := c.conn.Read(ctx)
+	return data, err
+}
+
+func (c *wsConn) write(ctx context.Context, data []byte) error {
+	return c.conn.Write(ctx, websocket.MessageBinary, data)
+}
+
+func (c *wsConn) close(code websocket.StatusCode, reason string) {
+	c.conn.Close(code, reason)
+}
+
+func (c *wsConn) drop() {
+	if c.net != nil {
+		c.net.Close()
+	}
+}
+
+type pipeConn struct {
+	conn pbc.Conn
+}
+
+func (c pipeConn) read(ctx context.Context) ([]byte, error) {
+	return c.conn.Read(ctx)
+}
+
+func (c pipeConn) write(ctx context.Context, data []byte) error {
+	return c.conn.Write(ctx, data)
+}
+
+func (c pipeConn) close(code websocket.StatusCode, reason string) {
+	c.conn.Close(reason)
+}
+
+func (c pipeConn) drop() {
+	c.conn.Close("")
+}
+
+// Keeps the network connection of a websocket, to be able to drop it.
+type hijackRecorder struct {
+	http.ResponseWriter
+	conn net.Conn
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := h.ResponseWriter.(http.Hijacker).Hijack()
+	h.conn = conn
+	return conn, rw, err
+}
@@ -0,0 +1,100 @@
+package pbc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+)
+
+// Requests waiting for their response.
+type pendingRequests struct {
+	mu       sync.Mutex
+	requests map[*pendingRequest]struct{}
+}
+
+type pendingRequest struct {
+	// Called for every incoming message, returns true (and the result) once it is the response.
+	handle func(posbus.Message) (bool, error)
+	// Set once the request is written to the connection.
+	sent atomic.Bool
+	done chan error
+}
+
+// Send a request and wait for its response.
+// The handle function is called (serialized) for every incoming message until it returns true,
+// together with the result of the request.
+// Fails with timeoutErr when there is no response in time,
+// or ErrConnectionClosed when the connection is lost after sending the request.
+func (c *Client) request(
+	ctx context.Context, req posbus.Message, timeout time.Duration, timeoutErr error,
+	handle func(posbus.Message) (bool, error),
+) error {
+	r := c.pending.add(handle)
+	defer c.pending.remove(r)
+
+	rctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := c.SendMessage(rctx, req); err != nil {
+		return err
+	}
+	r.sent.Store(true)
+	select {
+	case err := <-r.done:
+		return err
+	case <-rctx.Done():
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return timeoutErr
+	}
+}
+
+func (p *pendingRequests) add(handle func(posbus.Message) (bool, error)) *pendingRequest {
+	r := &pendingRequest{handle: handle, done: make(chan error, 1)}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.requests == nil {
+		p.requests = make(map[*pendingRequest]struct{})
+	}
+	p.requests[r] = struct{}{}
+	return r
+}
+
+func (p *pendingRequests) remove(r *pendingRequest) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.requests, r)
+}
+
+// Pass an incoming message to the pending requests.
+func (p *pendingRequests) dispatch(msg posbus.Message) {
+	p.mu.Lock()
+	if len(p.requests) == 0 {
+		p.mu.Unlock()
+		return
+	}
+	requests := make([]*pendingRequest, 0, len(p.requests))
+	for r := range p.requests {
+		requests = append(requests, r)
+	}
+	p.mu.Unlock()
+
+	sig, _ := msg.(*posbus.Signal)
+	lost := sig != nil && sig.Value == posbus.SignalConnectionClosed
+	for _, r := range requests {
+		if lost && r.sent.Load() {
+			// The response is not going to come on a new connection.
+			p.finish(r, ErrConnectionClosed)
+		} else if ok, err := r.handle(msg); ok {
+			p.finish(r, err)
+		}
+	}
+}
+
+func (p *pendingRequests) finish(r *pendingRequest, err error) {
+	p.remove(r)
+	r.done <- err
+}
@@ -0,0 +1,32 @@
+package pbc
+
+import (
+	"testing"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingRequests(t *testing.T) {
+	var p pendingRequests
+	isWorld := func(msg posbus.Message) (bool, error) {
+		_, ok := msg.(*posbus.SetWorld)
+		return ok, nil
+	}
+	r1 := p.add(isWorld)
+	r2 := p.add(isWorld)
+	r2.sent.Store(true)
+
+	p.dispatch(&posbus.AddUsers{})
+	assert.Empty(t, r1.done)
+	assert.Empty(t, r2.done)
+
+	// Only requests that were send are lost with the connection.
+	p.dispatch(&posbus.Signal{Value: posbus.SignalConnectionClosed})
+	assert.Empty(t, r1.done)
+	assert.ErrorIs(t, <-r2.done, ErrConnectionClosed)
+
+	p.dispatch(&posbus.SetWorld{})
+	assert.NoError(t, <-r1.done)
+	assert.Empty(t, p.requests)
+}
@@ -0,0 +1,228 @@
+package pbc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/pkg/errors"
+)
+
+// Priority of an outgoing message, higher priority messages are send first.
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+	numPriorities
+)
+
+// DefaultPriority of messages types.
+// Frequent position updates are low, so they can not hold up e.g. locking an object.
+func DefaultPriority(msgType posbus.MsgType) Priority {
+	switch msgType {
+	case posbus.TypeMyTransform:
+		return PriorityLow
+	case posbus.TypeHandShake,
+		posbus.TypeTeleportRequest,
+		posbus.TypeLockObject,
+		posbus.TypeUnlockObject:
+		return PriorityHigh
+	default:
+		return PriorityNormal
+	}
+}
+
+// OverflowStrategy determines what happens when a message is send while the send queue is full.
+type OverflowStrategy int
+
+const (
+	// Wait until there is room in the queue.
+	OverflowBlock OverflowStrategy = iota
+	// Drop the oldest queued message with the same or lower priority.
+	OverflowDropOldest
+	// Drop the message that is being send.
+	OverflowDropNewest
+	// Drop the connection as not-working (and reconnect), the queued messages are discarded.
+	OverflowDisconnect
+)
+
+var (
+	// The send queue is full, the message was dropped.
+	ErrQueueFull = errors.New("PBC: send queue full")
+	// The send queue was full and the connection was dropped.
+	errQueueOverflow = errors.New("PBC: send queue overflow")
+)
+
+type outMessage struct {
+	data     []byte
+	priority Priority
+	// Context of the sender, no need to write the message once it is done.
+	ctx context.Context
+	// Receives the result of writing the message.
+	done chan error
+}
+
+func newOutMessage(ctx context.Context, data []byte, priority Priority) outMessage {
+	return outMessage{data: data, priority: priority, ctx: ctx, done: make(chan error, 1)}
+}
+
+// Report the result of sending the message.
+func (m outMessage) result(err error) {
+	if m.done != nil {
+		m.done <- err
+	}
+}
+
+// Bounded queue of outgoing messages, per priority.
+// Filled by any goroutine that sends, emptied by the write pump.
+type sendQueue struct {
+	mu       sync.Mutex
+	items    [numPriorities][]outMessage
+	len      int
+	size     int
+	strategy OverflowStrategy
+	// Signals the write pump there is something in the queue.
+	ready chan struct{}
+	// Closed (and reset) when room is made in the queue.
+	space chan struct{}
+}
+
+func newSendQueue(size int, strategy OverflowStrategy) *sendQueue {
+	return &sendQueue{
+		size:     size,
+		strategy: strategy,
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// Add a message to the queue, handling a full queue according to the overflow strategy.
+func (q *sendQueue) push(ctx context.Context, m outMessage) error {
+	for {
+		q.mu.Lock()
+		if q.len < q.size || (q.strategy == OverflowDropOldest && q.dropOldest(m.priority)) {
+			q.items[m.priority] = append(q.items[m.priority], m)
+			q.len++
+			q.mu.Unlock()
+			select {
+			case q.ready <- struct{}{}:
+			default:
+			}
+			return nil
+		}
+		switch q.strategy {
+		case OverflowBlock:
+			if q.space == nil {
+				q.space = make(chan struct{})
+			}
+			space := q.space
+			q.mu.Unlock()
+			select {
+			case <-space:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case OverflowDisconnect:
+			q.clear(ErrConnectionClosed)
+			q.mu.Unlock()
+			return errQueueOverflow
+		default:
+			q.mu.Unlock()
+			return ErrQueueFull
+		}
+	}
+}
+
+// Put a message back in front of the queue, regardless of its size.
+// For a message that could not be written because the connection was lost.
+func (q *sendQueue) requeue(m outMessage) {
+	q.mu.Lock()
+	q.items[m.priority] = append([]outMessage{m}, q.items[m.priority]...)
+	q.len++
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Take the next message from the queue, waits until there is one.
+// Messages of which the sender already gave up are skipped.
+// Returns false when the context is done.
+func (q *sendQueue) pop(ctx context.Context) (outMessage, bool) {
+	for {
+		q.mu.Lock()
+		for p := numPriorities - 1; p >= 0; p-- {
+			for len(q.items[p]) > 0 {
+				m := q.items[p][0]
+				q.items[p][0] = outMessage{}
+				q.items[p] = q.items[p][1:]
+				q.len--
+				q.madeSpace()
+				if m.ctx != nil && m.ctx.Err() != nil {
+					m.result(m.ctx.Err())
+					continue
+				}
+				q.mu.Unlock()
+				return m, true
+			}
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return outMessage{}, false
+		}
+	}
+}
+
+// Number of messages in the queue.
+func (q *sendQueue) length() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.len
+}
+
+// Discard all queued messages, reporting the error to their senders.
+func (q *sendQueue) fail(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.clear(err)
+}
+
+// Drop the oldest message, from the lowest priority up to the given one.
+// Caller must hold the lock.
+func (q *sendQueue) dropOldest(upTo Priority) bool {
+	for p := PriorityLow; p <= upTo; p++ {
+		if len(q.items[p]) > 0 {
+			q.items[p][0].result(ErrQueueFull)
+			q.items[p][0] = outMessage{}
+			q.items[p] = q.items[p][1:]
+			q.len--
+			return true
+		}
+	}
+	return false
+}
+
+// Caller must hold the lock.
+func (q *sendQueue) clear(err error) {
+	for p := range q.items {
+		for _, m := range q.items[p] {
+			m.result(err)
+		}
+		q.items[p] = nil
+	}
+	q.len = 0
+	q.madeSpace()
+}
+
+// Wake up the senders waiting for room.
+// Caller must hold the lock.
+func (q *sendQueue) madeSpace() {
+	if q.space != nil {
+		close(q.space)
+		q.space = nil
+	}
+}
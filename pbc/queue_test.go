@@ -0,0 +1,70 @@
+package pbc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendQueuePriority(t *testing.T) {
+	ctx := context.Background()
+	q := newSendQueue(10, OverflowBlock)
+	require.NoError(t, q.push(ctx, outMessage{data: []byte("low1"), priority: PriorityLow}))
+	require.NoError(t, q.push(ctx, outMessage{data: []byte("normal"), priority: PriorityNormal}))
+	require.NoError(t, q.push(ctx, outMessage{data: []byte("low2"), priority: PriorityLow}))
+	require.NoError(t, q.push(ctx, outMessage{data: []byte("high"), priority: PriorityHigh}))
+
+	for _, expected := range []string{"high", "normal", "low1", "low2"} {
+		m, ok := q.pop(ctx)
+		require.True(t, ok)
+		assert.Equal(t, expected, string(m.data))
+	}
+	assert.Equal(t, 0, q.length())
+}
+
+func TestSendQueueOverflow(t *testing.T) {
+	ctx := context.Background()
+	low := outMessage{data: []byte("low"), priority: PriorityLow}
+	high := outMessage{data: []byte("high"), priority: PriorityHigh}
+
+	t.Run("drop newest", func(t *testing.T) {
+		q := newSendQueue(1, OverflowDropNewest)
+		require.NoError(t, q.push(ctx, low))
+		assert.ErrorIs(t, q.push(ctx, high), ErrQueueFull)
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		q := newSendQueue(1, OverflowDropOldest)
+		require.NoError(t, q.push(ctx, low))
+		require.NoError(t, q.push(ctx, high))
+		m, _ := q.pop(ctx)
+		assert.Equal(t, "high", string(m.data))
+		// Does not drop a message of higher priority.
+		require.NoError(t, q.push(ctx, high))
+		assert.ErrorIs(t, q.push(ctx, low), ErrQueueFull)
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		q := newSendQueue(1, OverflowDisconnect)
+		require.NoError(t, q.push(ctx, low))
+		assert.ErrorIs(t, q.push(ctx, high), errQueueOverflow)
+		assert.Equal(t, 0, q.length(), "queue is discarded")
+	})
+
+	t.Run("block", func(t *testing.T) {
+		q := newSendQueue(1, OverflowBlock)
+		require.NoError(t, q.push(ctx, low))
+		tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, q.push(tctx, high), context.DeadlineExceeded)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			q.pop(ctx)
+		}()
+		require.NoError(t, q.push(ctx, high), "unblocked by pop")
+	})
+}
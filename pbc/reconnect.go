@@ -0,0 +1,106 @@
+package pbc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The client stopped trying to (re)connect, as decided by its ReconnectPolicy.
+var ErrGaveUp = errors.New("PBC: gave up connecting")
+
+// ReconnectPolicy decides if and when a failed connection is retried.
+type ReconnectPolicy interface {
+	// NextDelay returns how long to wait before retry number attempt (starting at 1).
+	// Elapsed is the time since the connection was lost, or the first connect attempt.
+	// Returns false to give up.
+	NextDelay(attempt int, elapsed time.Duration) (time.Duration, bool)
+}
+
+// Upper limit of the delay of an ExponentialBackoff without a Max.
+const maxBackoffDelay = time.Hour
+
+// ExponentialBackoff doubles (or Multiplier) the delay between each retry, up to a maximum.
+type ExponentialBackoff struct {
+	// Delay before the first retry.
+	Initial time.Duration
+	// Upper limit of the delay (before jitter is applied), 0 is an hour.
+	Max time.Duration
+	// Factor to increase delay with on each retry. Default is 2.
+	Multiplier float64
+	// Fraction (0-1) of the delay to randomize.
+	// A delay d is turned into a random one between d*(1-Jitter) and d.
+	// Spreads the retries of many clients, so they don't all hit the server at the same moment.
+	Jitter float64
+	// Give up after this number of retries, 0 is unlimited.
+	MaxAttempts int
+	// Give up after this much time has passed, 0 is unlimited.
+	MaxElapsed time.Duration
+}
+
+// DefaultReconnectPolicy keeps retrying, with a delay from 500ms up to 30s.
+func DefaultReconnectPolicy() *ExponentialBackoff {
+	return &ExponentialBackoff{
+		Initial:    500 * time.Millisecond,
+		Max:        30 * time.Second,
+		Multiplier: 2,
+		Jitter:     0.5,
+	}
+}
+
+func (b *ExponentialBackoff) NextDelay(attempt int, elapsed time.Duration) (time.Duration, bool) {
+	if b.MaxAttempts > 0 && attempt > b.MaxAttempts {
+		return 0, false
+	}
+	multiplier := b.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	d := float64(b.Initial) * math.Pow(multiplier, float64(attempt-1))
+	limit := b.Max
+	if limit <= 0 {
+		limit = maxBackoffDelay
+	}
+	// Grows to +Inf after enough attempts, which is not a duration.
+	if d > float64(limit) || math.IsNaN(d) {
+		d = float64(limit)
+	}
+	if b.Jitter > 0 {
+		d -= d * math.Min(b.Jitter, 1) * rand.Float64()
+	}
+	delay := time.Duration(d)
+	if b.MaxElapsed > 0 && elapsed+delay > b.MaxElapsed {
+		return 0, false
+	}
+	return delay, true
+}
+
+// NeverReconnect does not retry, a lost connection is final.
+var NeverReconnect ReconnectPolicy = neverReconnect{}
+
+type neverReconnect struct{}
+
+func (neverReconnect) NextDelay(int, time.Duration) (time.Duration, bool) {
+	return 0, false
+}
+
+// Wait for the next retry, as given by the reconnect policy.
+func (c *Client) waitRetry(ctx context.Context, attempt int, start time.Time, lastErr error) error {
+	delay, ok := c.reconnectPolicy.NextDelay(attempt, time.Since(start))
+	if !ok {
+		return fmt.Errorf("%w (retry %d): %w", ErrGaveUp, attempt, lastErr)
+	}
+	c.log.Debugf("PBC: retry %d in %s", attempt, delay)
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
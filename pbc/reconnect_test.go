@@ -0,0 +1,63 @@
+package pbc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := &ExponentialBackoff{
+		Initial:     100 * time.Millisecond,
+		Max:         time.Second,
+		MaxAttempts: 6,
+	}
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, e := range expected {
+		d, ok := b.NextDelay(i+1, 0)
+		assert.True(t, ok, "retry %d", i+1)
+		assert.Equal(t, e, d, "delay of retry %d", i+1)
+	}
+	_, ok := b.NextDelay(len(expected)+1, 0)
+	assert.False(t, ok, "give up after max attempts")
+
+	b.MaxElapsed = 5 * time.Second
+	_, ok = b.NextDelay(1, 5*time.Second)
+	assert.False(t, ok, "give up after max elapsed time")
+}
+
+func TestExponentialBackoffUnlimited(t *testing.T) {
+	b := &ExponentialBackoff{Initial: time.Second}
+	for _, attempt := range []int{20, 100, 2000} {
+		d, ok := b.NextDelay(attempt, 0)
+		assert.True(t, ok)
+		assert.Equal(t, maxBackoffDelay, d, "delay of retry %d", attempt)
+	}
+	b = &ExponentialBackoff{Initial: time.Second, Max: time.Minute, Jitter: 0.5}
+	d, _ := b.NextDelay(5000, 0)
+	assert.Greater(t, d, 29*time.Second)
+	assert.LessOrEqual(t, d, time.Minute)
+}
+
+func TestExponentialBackoffJitter(t *testing.T) {
+	b := &ExponentialBackoff{Initial: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		d, ok := b.NextDelay(1, 0)
+		assert.True(t, ok)
+		assert.GreaterOrEqual(t, d, 500*time.Millisecond)
+		assert.LessOrEqual(t, d, time.Second)
+	}
+}
+
+func TestNeverReconnect(t *testing.T) {
+	_, ok := NeverReconnect.NextDelay(1, 0)
+	assert.False(t, ok)
+}
@@ -0,0 +1,30 @@
+package pbc
+
+import (
+	"github.com/momentum-xyz/posbus-client/pbc/capture"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+)
+
+// Recorder receives a copy of every frame the client sends and receives, see WithRecorder.
+// A capture.Writer is a Recorder.
+type Recorder interface {
+	Record(dir capture.Direction, data []byte) error
+}
+
+// Pass a frame to the recorder, if there is one.
+// The token is removed from the handshake, recordings are shared when reporting issues.
+func (c *Client) record(dir capture.Direction, data []byte) {
+	if c.recorder == nil {
+		return
+	}
+	if dir == capture.Outbound && posbus.MessageType(data) == posbus.TypeHandShake {
+		var hs posbus.HandShake
+		if err := posbus.DecodeTo(data, &hs); err == nil {
+			hs.Token = ""
+			data = posbus.BinMessage(&hs)
+		}
+	}
+	if err := c.recorder.Record(dir, data); err != nil {
+		c.log.Debugf("PBC: record: %v", err)
+	}
+}
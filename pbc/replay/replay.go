@@ -0,0 +1,185 @@
+// Package replay plays back a capture recorded with pbc.WithRecorder.
+//
+// The messages the client received are passed to a callback, like the one of pbc.Client,
+// at the recorded pace, faster, or one at a time:
+//
+//	rec, err := replay.LoadFile("session.pbcap")
+//	p := rec.Player(2)
+//	err = p.Play(ctx, func(msg posbus.Message) { ... })
+//
+// Or served over a websocket, to replay against any client, e.g. the browser one:
+//
+//	http.ListenAndServe("localhost:4001", rec.Handler(1))
+package replay
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/momentum-xyz/posbus-client/pbc/capture"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidFrame is returned for a recorded frame that is not a (known) message.
+// The player moves past it, so stepping or playing again continues with the next one.
+var ErrInvalidFrame = errors.New("replay: invalid frame")
+
+// Recording is a capture loaded into memory, so it can be played multiple times.
+type Recording struct {
+	// Wall clock time the recording started.
+	Start time.Time
+	// All recorded frames, in both directions.
+	Frames []capture.Frame
+}
+
+// Load reads all frames of a capture.
+func Load(r *capture.Reader) (*Recording, error) {
+	rec := &Recording{Start: r.Start}
+	for {
+		f, err := r.Next()
+		if err == io.EOF {
+			return rec, nil
+		}
+		if err != nil {
+			return nil, errors.WithMessagef(err, "replay: frame %d", len(rec.Frames))
+		}
+		rec.Frames = append(rec.Frames, f)
+	}
+}
+
+// LoadFile reads all frames of a capture file.
+func LoadFile(path string) (*Recording, error) {
+	r, err := capture.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return Load(r)
+}
+
+// Player creates a player for the frames the client received.
+// The speed is relative to the recording: 1 is real time and 2 twice as fast.
+// Zero (or less) plays back without any delays.
+func (rec *Recording) Player(speed float64) *Player {
+	return &Player{rec: rec, speed: speed}
+}
+
+// Player keeps the position in a recording, not safe for concurrent use.
+type Player struct {
+	rec   *Recording
+	speed float64
+	pos   int
+	// Time of the last played frame, to wait relative to.
+	last    time.Duration
+	started bool
+}
+
+// Remaining returns the number of frames left to play.
+func (p *Player) Remaining() int {
+	n := 0
+	for _, f := range p.rec.Frames[p.pos:] {
+		if f.Direction == capture.Inbound {
+			n++
+		}
+	}
+	return n
+}
+
+// Step passes the next message to f right away, without waiting.
+// Returns io.EOF at the end of the recording, and ErrInvalidFrame for a frame that can not be decoded.
+func (p *Player) Step(f func(msg posbus.Message)) error {
+	frame, err := p.next()
+	if err != nil {
+		return err
+	}
+	return deliver(frame, f)
+}
+
+// Play passes the remaining messages to f, at the speed of the player.
+// Playback continues where a previous Step or Play stopped, it stops at a frame that can not be decoded (ErrInvalidFrame).
+func (p *Player) Play(ctx context.Context, f func(msg posbus.Message)) error {
+	return p.playFrames(ctx, func(frame capture.Frame) error {
+		return deliver(frame, f)
+	})
+}
+
+// Play the raw frames, waiting between them.
+func (p *Player) playFrames(ctx context.Context, f func(capture.Frame) error) error {
+	for {
+		frame, ok := p.peek()
+		if !ok {
+			return nil
+		}
+		if err := p.wait(ctx, frame.Time); err != nil {
+			return err
+		}
+		p.next()
+		if err := f(frame); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *Player) wait(ctx context.Context, t time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.speed <= 0 || !p.started {
+		return nil
+	}
+	d := time.Duration(float64(t-p.last) / p.speed)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// The next inbound frame, without moving on.
+func (p *Player) peek() (capture.Frame, bool) {
+	for i := p.pos; i < len(p.rec.Frames); i++ {
+		if p.rec.Frames[i].Direction == capture.Inbound {
+			return p.rec.Frames[i], true
+		}
+	}
+	return capture.Frame{}, false
+}
+
+// Move on to the next inbound frame.
+func (p *Player) next() (capture.Frame, error) {
+	for p.pos < len(p.rec.Frames) {
+		f := p.rec.Frames[p.pos]
+		p.pos++
+		if f.Direction == capture.Inbound {
+			p.last = f.Time
+			p.started = true
+			return f, nil
+		}
+	}
+	return capture.Frame{}, io.EOF
+}
+
+func deliver(frame capture.Frame, f func(msg posbus.Message)) error {
+	// Frames are recorded before the client checks them, Decode panics on these.
+	data := frame.Data
+	if len(data) < 2*posbus.MsgTypeSize || posbus.MessageType(data) == 0 {
+		return errors.Wrapf(ErrInvalidFrame, "%d bytes at %s", len(data), frame.Time)
+	}
+	if msgType := posbus.MessageType(data); posbus.MessageDataTypeById(msgType) == nil {
+		return errors.Wrapf(ErrInvalidFrame, "unknown message type %#x at %s", uint32(msgType), frame.Time)
+	}
+	msg, err := posbus.Decode(data)
+	if err != nil {
+		return errors.Wrapf(ErrInvalidFrame, "decode at %s: %s", frame.Time, err)
+	}
+	f(msg)
+	return nil
+}
@@ -0,0 +1,158 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/momentum-xyz/posbus-client/pbc"
+	"github.com/momentum-xyz/posbus-client/pbc/capture"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+)
+
+var worldID = umid.New()
+
+func testRecording(t *testing.T) *Recording {
+	var buf bytes.Buffer
+	w, err := capture.NewWriter(&buf)
+	require.NoError(t, err)
+	frames := []capture.Frame{
+		{Time: 0, Direction: capture.Outbound, Data: posbus.BinMessage(&posbus.HandShake{})},
+		{Time: 10 * time.Millisecond, Direction: capture.Outbound, Data: posbus.BinMessage(&posbus.TeleportRequest{Target: worldID})},
+		{Time: 20 * time.Millisecond, Direction: capture.Inbound, Data: posbus.BinMessage(&posbus.SetWorld{ID: worldID, Name: "replayed"})},
+		{Time: 120 * time.Millisecond, Direction: capture.Inbound, Data: posbus.BinMessage(&posbus.AddObjects{})},
+		{Time: 220 * time.Millisecond, Direction: capture.Inbound, Data: posbus.BinMessage(&posbus.AddUsers{})},
+	}
+	for _, f := range frames {
+		require.NoError(t, w.WriteFrame(f))
+	}
+	require.NoError(t, w.Close())
+	r, err := capture.NewReader(&buf)
+	require.NoError(t, err)
+	rec, err := Load(r)
+	require.NoError(t, err)
+	require.Len(t, rec.Frames, len(frames))
+	return rec
+}
+
+func messageNames(msgs []posbus.Message) []string {
+	names := make([]string, len(msgs))
+	for i, m := range msgs {
+		names[i] = posbus.MessageNameById(m.GetType())
+	}
+	return names
+}
+
+func TestStep(t *testing.T) {
+	p := testRecording(t).Player(1)
+	assert.Equal(t, 3, p.Remaining())
+
+	var got []posbus.Message
+	collect := func(msg posbus.Message) { got = append(got, msg) }
+	require.NoError(t, p.Step(collect))
+	require.IsType(t, &posbus.SetWorld{}, got[0])
+	assert.Equal(t, "replayed", got[0].(*posbus.SetWorld).Name)
+	assert.Equal(t, 2, p.Remaining())
+
+	// Continues where stepping stopped.
+	require.NoError(t, p.Play(context.Background(), collect))
+	assert.Equal(t, []string{"set_world", "add_objects", "add_users"}, messageNames(got))
+	assert.ErrorIs(t, p.Step(collect), io.EOF)
+}
+
+func TestPlaySpeed(t *testing.T) {
+	rec := testRecording(t)
+	var n int
+	count := func(posbus.Message) { n++ }
+
+	start := time.Now()
+	require.NoError(t, rec.Player(0).Play(context.Background(), count))
+	assert.Less(t, time.Since(start), 100*time.Millisecond, "no delays")
+
+	start = time.Now()
+	require.NoError(t, rec.Player(2).Play(context.Background(), count))
+	// 200ms between the first and last message, at twice the speed.
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, 6, n)
+}
+
+func TestPlayCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := testRecording(t).Player(0.01)
+	err := p.Play(ctx, func(posbus.Message) { cancel() })
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 2, p.Remaining())
+}
+
+func TestHandler(t *testing.T) {
+	srv := httptest.NewServer(testRecording(t).Handler(0))
+	defer srv.Close()
+
+	received := make(chan posbus.Message, 10)
+	client := pbc.NewClient()
+	defer client.Close()
+	client.SetCallback(func(msg posbus.Message) {
+		// Connection signals come from the client itself.
+		if _, ok := msg.(*posbus.Signal); !ok {
+			received <- msg
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/posbus"
+	require.NoError(t, client.Connect(ctx, url, "token", umid.New()))
+
+	var got []posbus.Message
+	for len(got) < 3 {
+		select {
+		case msg := <-received:
+			got = append(got, msg)
+		case <-ctx.Done():
+			t.Fatalf("replayed %v", messageNames(got))
+		}
+	}
+	assert.Equal(t, []string{"set_world", "add_objects", "add_users"}, messageNames(got))
+}
+
+func TestInvalidFrames(t *testing.T) {
+	unknown := make([]byte, 12)
+	binary.LittleEndian.PutUint32(unknown, 0x12345678)
+	binary.LittleEndian.PutUint32(unknown[8:], ^uint32(0x12345678))
+	rec := &Recording{Frames: []capture.Frame{
+		{Direction: capture.Inbound, Data: []byte{1, 2, 3}},
+		{Direction: capture.Inbound, Data: unknown},
+		{Direction: capture.Inbound, Data: posbus.BinMessage(&posbus.AddUsers{})},
+	}}
+
+	var got []posbus.Message
+	collect := func(msg posbus.Message) { got = append(got, msg) }
+	p := rec.Player(0)
+	assert.ErrorIs(t, p.Step(collect), ErrInvalidFrame, "truncated")
+	assert.ErrorIs(t, p.Play(context.Background(), collect), ErrInvalidFrame, "unknown type")
+	// Moved past them.
+	require.NoError(t, p.Play(context.Background(), collect))
+	assert.Equal(t, []string{"add_users"}, messageNames(got))
+}
+
+func TestHandlerInvalidHandshake(t *testing.T) {
+	srv := httptest.NewServer(testRecording(t).Handler(0))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, srv.URL, nil)
+	require.NoError(t, err)
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	require.NoError(t, conn.Write(ctx, websocket.MessageBinary, []byte{1}))
+	_, _, err = conn.Read(ctx)
+	assert.Equal(t, websocket.StatusPolicyViolation, websocket.CloseStatus(err))
+}
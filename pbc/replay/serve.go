@@ -0,0 +1,61 @@
+package replay
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/momentum-xyz/posbus-client/pbc/capture"
+	"github.com/momentum-xyz/ubercontroller/logger"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/pkg/errors"
+	"nhooyr.io/websocket"
+)
+
+// Handler serves the recording as a posbus websocket endpoint, on any path.
+// Every connection gets a playback from the start, after it sent its handshake.
+// What the client sends is ignored, the connection stays open at the end of the recording.
+func (rec *Recording) Handler(speed float64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			// For local debugging of the browser client, served from anywhere.
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			logger.L().Debugf("replay: accept: %v", err)
+			return
+		}
+		defer conn.Close(websocket.StatusNormalClosure, "")
+		if err := rec.serve(r.Context(), conn, speed); err != nil {
+			logger.L().Infof("replay: %v", err)
+		}
+	})
+}
+
+func (rec *Recording) serve(ctx context.Context, conn *websocket.Conn, speed float64) error {
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		return nil
+	}
+	if len(data) < 2*posbus.MsgTypeSize {
+		conn.Close(websocket.StatusPolicyViolation, "expected handshake")
+		return errors.Errorf("replay: handshake of %d bytes", len(data))
+	}
+	if posbus.MessageType(data) != posbus.TypeHandShake {
+		conn.Close(websocket.StatusPolicyViolation, "expected handshake")
+		return nil
+	}
+	// Discard the rest, done when the client closes.
+	ctx = conn.CloseRead(ctx)
+	p := rec.Player(speed)
+	err = p.playFrames(ctx, func(f capture.Frame) error {
+		return conn.Write(ctx, websocket.MessageBinary, f.Data)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	<-ctx.Done()
+	return nil
+}
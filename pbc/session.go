@@ -0,0 +1,328 @@
+package pbc
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+)
+
+// Time to wait for the world to be send again after reconnecting.
+const resumeTimeout = 10 * time.Second
+
+// Resume describes what changed while the client was reconnecting.
+type Resume struct {
+	// World the client is back in.
+	World umid.UMID
+	// Time between losing the connection and resuming.
+	Downtime time.Duration
+	// Objects that are new or changed.
+	AddedObjects []umid.UMID
+	// Objects that are gone.
+	RemovedObjects []umid.UMID
+	// Users that joined the world.
+	AddedUsers []umid.UMID
+	// Users that left the world.
+	RemovedUsers []umid.UMID
+	// Object locks that were held before and acquired again.
+	LocksRestored []umid.UMID
+	// Object locks that were held before, but could not be acquired again.
+	LocksLost []umid.UMID
+}
+
+// OnResume registers a function that gets called after reconnecting, once the world is restored.
+// While resuming, the callback only receives the parts of the world that changed,
+// instead of a duplicate of the whole world.
+// Returns a function to unsubscribe again.
+func (c *Client) OnResume(f func(Resume)) (unsubscribe func()) {
+	return c.resumeListeners.Add(f)
+}
+
+// HeldLocks returns the IDs of the objects this client holds a lock on.
+func (c *Client) HeldLocks() []umid.UMID {
+	c.session.mu.Lock()
+	defer c.session.mu.Unlock()
+	return setKeys(c.session.locks)
+}
+
+// State of the current session, to be able to resume it after a reconnect.
+type session struct {
+	mu            sync.Mutex
+	world         umid.UMID
+	objects       map[umid.UMID]posbus.ObjectDefinition
+	users         map[umid.UMID]struct{}
+	locks         map[umid.UMID]struct{}
+	lastTransform []byte
+	resume        *resumeState
+}
+
+type resumeState struct {
+	generation   uint64
+	lostAt       time.Time
+	seenObjects  map[umid.UMID]posbus.ObjectDefinition
+	seenUsers    map[umid.UMID]struct{}
+	pendingLocks map[umid.UMID]struct{}
+	worldLoaded  bool
+	result       Resume
+}
+
+func newSession() *session {
+	s := &session{}
+	s.reset(umid.Nil)
+	return s
+}
+
+// Start with a new (or no) world.
+// Caller must hold the lock.
+func (s *session) reset(world umid.UMID) {
+	s.world = world
+	s.objects = make(map[umid.UMID]posbus.ObjectDefinition)
+	s.users = make(map[umid.UMID]struct{})
+	s.locks = make(map[umid.UMID]struct{})
+}
+
+// Keep track of what this client sends.
+func (s *session) sent(msg []byte) {
+	switch posbus.MessageType(msg) {
+	case posbus.TypeMyTransform:
+		s.mu.Lock()
+		s.lastTransform = msg
+		s.mu.Unlock()
+	case posbus.TypeUnlockObject:
+		var m posbus.UnlockObject
+		if err := posbus.DecodeTo(msg, &m); err == nil {
+			s.mu.Lock()
+			delete(s.locks, m.ID)
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Prepare for resuming the session on a new connection.
+// Returns the messages to send to restore it.
+func (s *session) beginResume(generation uint64, lostAt time.Time) [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.world == umid.Nil {
+		return nil
+	}
+	if r := s.resume; r != nil {
+		// Lost again while resuming, what was already received is known now.
+		for id, o := range r.seenObjects {
+			s.objects[id] = o
+		}
+		for id := range r.seenUsers {
+			s.users[id] = struct{}{}
+		}
+		lostAt = r.lostAt
+	}
+	s.resume = &resumeState{
+		generation:   generation,
+		lostAt:       lostAt,
+		seenObjects:  make(map[umid.UMID]posbus.ObjectDefinition),
+		seenUsers:    make(map[umid.UMID]struct{}),
+		pendingLocks: make(map[umid.UMID]struct{}),
+		result:       Resume{World: s.world},
+	}
+	msgs := [][]byte{posbus.BinMessage(&posbus.TeleportRequest{Target: s.world})}
+	if s.lastTransform != nil {
+		msgs = append(msgs, s.lastTransform)
+	}
+	for id := range s.locks {
+		s.resume.pendingLocks[id] = struct{}{}
+		msgs = append(msgs, posbus.BinMessage(&posbus.LockObject{ID: id}))
+	}
+	return msgs
+}
+
+// Handle an incoming message.
+// Returns the messages to pass on to the user of the client,
+// and the result when resuming is done.
+func (s *session) handle(msg posbus.Message, self umid.UMID) ([]posbus.Message, *Resume) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resume != nil {
+		return s.handleResuming(msg, self)
+	}
+	switch m := msg.(type) {
+	case *posbus.SetWorld:
+		if m.ID != s.world {
+			s.reset(m.ID)
+		}
+	case *posbus.AddObjects:
+		for _, o := range m.Objects {
+			s.objects[o.ID] = o
+		}
+	case *posbus.RemoveObjects:
+		for _, id := range m.Objects {
+			delete(s.objects, id)
+		}
+	case *posbus.AddUsers:
+		for _, u := range m.Users {
+			s.users[u.ID] = struct{}{}
+		}
+	case *posbus.RemoveUsers:
+		for _, id := range m.Users {
+			delete(s.users, id)
+		}
+	case *posbus.LockObjectResponse:
+		s.updateLock(m, self)
+	}
+	return []posbus.Message{msg}, nil
+}
+
+// Caller must hold the lock.
+func (s *session) handleResuming(msg posbus.Message, self umid.UMID) ([]posbus.Message, *Resume) {
+	r := s.resume
+	switch m := msg.(type) {
+	case *posbus.SetWorld:
+		if m.ID == s.world {
+			return nil, nil
+		}
+		// Ended up somewhere else, so everything is new.
+		result := s.finishResume()
+		result.World = m.ID
+		result.RemovedObjects = setKeys(s.objects)
+		result.RemovedUsers = setKeys(s.users)
+		s.reset(m.ID)
+		return []posbus.Message{msg}, result
+	case *posbus.MyTransform:
+		if s.lastTransform != nil {
+			// We put ourselves back where we were.
+			return nil, nil
+		}
+	case *posbus.AddObjects:
+		changed := make([]posbus.ObjectDefinition, 0, len(m.Objects))
+		for _, o := range m.Objects {
+			r.seenObjects[o.ID] = o
+			if prev, ok := s.objects[o.ID]; !ok || !reflect.DeepEqual(prev, o) {
+				changed = append(changed, o)
+				r.result.AddedObjects = append(r.result.AddedObjects, o.ID)
+			}
+		}
+		if len(changed) == 0 {
+			return nil, nil
+		}
+		return []posbus.Message{&posbus.AddObjects{Objects: changed}}, nil
+	case *posbus.RemoveObjects:
+		for _, id := range m.Objects {
+			delete(r.seenObjects, id)
+			delete(s.objects, id)
+		}
+	case *posbus.AddUsers:
+		added := make([]posbus.UserData, 0, len(m.Users))
+		for _, u := range m.Users {
+			r.seenUsers[u.ID] = struct{}{}
+			if _, ok := s.users[u.ID]; !ok {
+				added = append(added, u)
+				r.result.AddedUsers = append(r.result.AddedUsers, u.ID)
+			}
+		}
+		if len(added) == 0 {
+			return nil, nil
+		}
+		return []posbus.Message{&posbus.AddUsers{Users: added}}, nil
+	case *posbus.RemoveUsers:
+		for _, id := range m.Users {
+			delete(r.seenUsers, id)
+			delete(s.users, id)
+		}
+	case *posbus.LockObjectResponse:
+		if _, ok := r.pendingLocks[m.ID]; ok {
+			delete(r.pendingLocks, m.ID)
+			if m.Result == 1 && m.LockOwner == self {
+				r.result.LocksRestored = append(r.result.LocksRestored, m.ID)
+			} else {
+				r.result.LocksLost = append(r.result.LocksLost, m.ID)
+			}
+		}
+		s.updateLock(m, self)
+	case *posbus.UsersTransformList:
+		// Send periodically once in a world, so by now the world has been send.
+		r.worldLoaded = true
+	}
+	if r.worldLoaded && len(r.pendingLocks) == 0 {
+		return s.resumeDone(msg)
+	}
+	return []posbus.Message{msg}, nil
+}
+
+// Finish resuming (because of timeout).
+// Returns nil if not resuming (anymore).
+func (s *session) timeoutResume(generation uint64) ([]posbus.Message, *Resume) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resume == nil || s.resume.generation != generation {
+		return nil, nil
+	}
+	return s.resumeDone(nil)
+}
+
+// Returns the given message, preceded by messages for what was removed while disconnected.
+// Caller must hold the lock.
+func (s *session) resumeDone(msg posbus.Message) ([]posbus.Message, *Resume) {
+	r := s.resume
+	var removedObjects, removedUsers []umid.UMID
+	for id := range s.objects {
+		if _, ok := r.seenObjects[id]; !ok {
+			removedObjects = append(removedObjects, id)
+		}
+	}
+	for id := range s.users {
+		if _, ok := r.seenUsers[id]; !ok {
+			removedUsers = append(removedUsers, id)
+		}
+	}
+	result := s.finishResume()
+	result.RemovedObjects = removedObjects
+	result.RemovedUsers = removedUsers
+	s.objects = r.seenObjects
+	s.users = r.seenUsers
+
+	var msgs []posbus.Message
+	if len(removedObjects) > 0 {
+		msgs = append(msgs, &posbus.RemoveObjects{Objects: removedObjects})
+	}
+	if len(removedUsers) > 0 {
+		msgs = append(msgs, &posbus.RemoveUsers{Users: removedUsers})
+	}
+	if msg != nil {
+		msgs = append(msgs, msg)
+	}
+	return msgs, result
+}
+
+// Caller must hold the lock.
+func (s *session) finishResume() *Resume {
+	r := s.resume
+	s.resume = nil
+	for id := range r.pendingLocks {
+		r.result.LocksLost = append(r.result.LocksLost, id)
+	}
+	for _, id := range r.result.LocksLost {
+		delete(s.locks, id)
+	}
+	r.result.Downtime = time.Since(r.lostAt)
+	return &r.result
+}
+
+// Caller must hold the lock.
+func (s *session) updateLock(m *posbus.LockObjectResponse, self umid.UMID) {
+	switch {
+	case m.Result == 1 && m.LockOwner == self:
+		s.locks[m.ID] = struct{}{}
+	case m.LockOwner != self:
+		// Unlocked, or someone else has it.
+		delete(s.locks, m.ID)
+	}
+}
+
+func setKeys[V any](m map[umid.UMID]V) []umid.UMID {
+	keys := make([]umid.UMID, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
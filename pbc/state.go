@@ -0,0 +1,146 @@
+package pbc
+
+import (
+	"sync"
+
+	"github.com/momentum-xyz/posbus-client/pbc/internal/listeners"
+	"github.com/pkg/errors"
+)
+
+// ConnectionState of a Client.
+type ConnectionState uint32
+
+const (
+	// Client created, but never connected.
+	StateIdle ConnectionState = iota
+	// Setting up the (initial) websocket connection.
+	StateDialing
+	// Websocket connected, authenticating with the posbus handshake.
+	StateHandshaking
+	// Connected and ready to send and receive messages.
+	StateConnected
+	// Connection was lost and the client is trying to get it back.
+	StateReconnecting
+	// Connection closed on request of the user of the client.
+	StateClosed
+	// Connection lost and the client gave up on it.
+	StateFailed
+	// The server did not accept the handshake, or the token expired without a way to get a new one.
+	// A rejected handshake is not answered, it is assumed after a few connections in a row
+	// that are closed right away (or never answer a ping) without receiving anything.
+	// Connect does not wait for that, it returns once the handshake is sent.
+	StateAuthFailed
+)
+
+var stateNames = [...]string{
+	StateIdle:         "idle",
+	StateDialing:      "dialing",
+	StateHandshaking:  "handshaking",
+	StateConnected:    "connected",
+	StateReconnecting: "reconnecting",
+	StateClosed:       "closed",
+	StateFailed:       "failed",
+	StateAuthFailed:   "auth-failed",
+}
+
+func (s ConnectionState) String() string {
+	if int(s) < len(stateNames) {
+		return stateNames[s]
+	}
+	return "unknown"
+}
+
+// Terminal states are not left, unless Connect is called again.
+func (s ConnectionState) IsTerminal() bool {
+	return s == StateClosed || s == StateFailed || s == StateAuthFailed
+}
+
+// StateChange is a transition of the connection state.
+type StateChange struct {
+	From ConnectionState
+	To   ConnectionState
+	// Reason for the transition.
+	// Nil for transitions requested by the user of the client (e.g. Connect, Close).
+	// Otherwise the error that caused it: io.EOF (wrapping a websocket.CloseError) when closed by the server,
+	// context.Canceled (or DeadlineExceeded) when the context of the client ended,
+	// or the error of a failed read.
+	Cause error
+}
+
+// The server connected the user with another session, this one is not coming back.
+var ErrDualConnection = errors.New("PBC: user connected from another session")
+
+type stateMachine struct {
+	mu      sync.Mutex
+	current ConnectionState
+	// Transitions not delivered yet, in order, and whether a goroutine is delivering them.
+	pending   []StateChange
+	emitting  bool
+	listeners listeners.List[StateChange]
+}
+
+// State returns the current connection state.
+func (c *Client) State() ConnectionState {
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+	return c.state.current
+}
+
+// OnStateChange registers a function that gets called on every connection state transition.
+// Transitions are passed in order, one at a time. It is called from the goroutine that caused the transition
+// (or the one passing an earlier transition), so should not block.
+// Returns a function to unsubscribe again.
+func (c *Client) OnStateChange(f func(StateChange)) (unsubscribe func()) {
+	return c.state.listeners.Add(f)
+}
+
+// Transition to a new state.
+// Once in a terminal state, only a new connection attempt (dialing) can leave it.
+func (c *Client) setState(to ConnectionState, cause error) bool {
+	c.state.mu.Lock()
+	from := c.state.current
+	if from == to || (from.IsTerminal() && to != StateDialing) {
+		c.state.mu.Unlock()
+		return false
+	}
+	c.state.current = to
+	sc := StateChange{From: from, To: to, Cause: cause}
+	c.state.pending = append(c.state.pending, sc)
+	deliver := !c.state.emitting
+	c.state.emitting = true
+	c.state.mu.Unlock()
+
+	if to.IsTerminal() {
+		c.queue.fail(ErrConnectionClosed)
+		c.metrics.QueueLength(0)
+	}
+
+	c.log.Debugf("PBC: state %s -> %s (%v)", from, to, cause)
+	if to == StateConnected {
+		// Only lines while (re)connecting have an attempt.
+		c.logCtx.setAttempt(0)
+	}
+	if deliver {
+		c.emitStateChanges()
+	}
+	return true
+}
+
+// Pass the pending transitions to the metrics and listeners, in the order they happened.
+// Transitions made meanwhile, by other goroutines or the listeners themselves, are passed on by this loop too.
+func (c *Client) emitStateChanges() {
+	for {
+		c.state.mu.Lock()
+		if len(c.state.pending) == 0 {
+			c.state.emitting = false
+			c.state.mu.Unlock()
+			return
+		}
+		sc := c.state.pending[0]
+		c.state.pending = c.state.pending[1:]
+		c.state.mu.Unlock()
+
+		c.metrics.StateChange(sc)
+		c.state.listeners.Emit(sc)
+	}
+}
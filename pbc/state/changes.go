@@ -0,0 +1,59 @@
+package state
+
+import "github.com/momentum-xyz/ubercontroller/utils/umid"
+
+// ChangeType is the kind of change made to the world model.
+type ChangeType int
+
+const (
+	// Entered a (new) world, or its definition changed.
+	WorldChanged ChangeType = iota
+	ObjectAdded
+	// Definition of an existing object was send again.
+	ObjectChanged
+	ObjectRemoved
+	ObjectMoved
+	ObjectDataChanged
+	UserAdded
+	UserRemoved
+	UserMoved
+	AttributeChanged
+	AttributeRemoved
+)
+
+var changeNames = [...]string{
+	WorldChanged:      "world changed",
+	ObjectAdded:       "object added",
+	ObjectChanged:     "object changed",
+	ObjectRemoved:     "object removed",
+	ObjectMoved:       "object moved",
+	ObjectDataChanged: "object data changed",
+	UserAdded:         "user added",
+	UserRemoved:       "user removed",
+	UserMoved:         "user moved",
+	AttributeChanged:  "attribute changed",
+	AttributeRemoved:  "attribute removed",
+}
+
+func (t ChangeType) String() string {
+	if t >= 0 && int(t) < len(changeNames) {
+		return changeNames[t]
+	}
+	return "unknown"
+}
+
+// Change made to the world model.
+type Change struct {
+	Type ChangeType
+	// ID of the world, object or user that changed.
+	ID umid.UMID
+	// Set for attribute changes.
+	Attribute AttributeKey
+}
+
+// Subscribe registers a function that gets called for every change of the model.
+// It is called after the change is applied, from the goroutine calling Handle, so should not block.
+// Returns a function to unsubscribe again.
+func (w *World) Subscribe(f func(Change)) (unsubscribe func()) {
+	return w.listeners.Add(f)
+}
@@ -0,0 +1,301 @@
+// Package state keeps an in-memory model of the world a client is in.
+//
+// Feed it all incoming messages of a pbc.Client and query it from any goroutine:
+//
+//	world := state.New(userID)
+//	client.OnAny(world.Handle)
+//
+// Returned values are copies of the current state,
+// but attribute values are shared and should be treated as read-only.
+package state
+
+import (
+	"sync"
+
+	"github.com/momentum-xyz/posbus-client/pbc/internal/listeners"
+	"github.com/momentum-xyz/ubercontroller/pkg/cmath"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/types/entry"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+)
+
+// Object in the world.
+type Object struct {
+	posbus.ObjectDefinition
+	// Object data (auto attributes) by slot type.
+	Data map[entry.SlotType]posbus.StringAnyMap
+}
+
+// User in the world.
+type User struct {
+	posbus.UserData
+}
+
+// World is a concurrent-safe model of the current world.
+type World struct {
+	mu         sync.RWMutex
+	self       umid.UMID
+	info       posbus.SetWorld
+	objects    map[umid.UMID]*posbus.ObjectDefinition
+	data       map[umid.UMID]map[entry.SlotType]posbus.StringAnyMap
+	children   map[umid.UMID]map[umid.UMID]struct{}
+	users      map[umid.UMID]*User
+	attributes map[AttributeKey]posbus.StringAnyMap
+	listeners  listeners.List[Change]
+}
+
+// AttributeKey identifies an attribute of an object or user.
+type AttributeKey struct {
+	TargetID umid.UMID
+	PluginID umid.UMID
+	Name     string
+}
+
+// New creates an empty world model, for the client of the given user.
+func New(self umid.UMID) *World {
+	w := &World{self: self}
+	w.reset(posbus.SetWorld{})
+	return w
+}
+
+// Caller must hold the (write) lock.
+func (w *World) reset(info posbus.SetWorld) {
+	w.info = info
+	w.objects = make(map[umid.UMID]*posbus.ObjectDefinition)
+	w.data = make(map[umid.UMID]map[entry.SlotType]posbus.StringAnyMap)
+	w.children = make(map[umid.UMID]map[umid.UMID]struct{})
+	w.users = make(map[umid.UMID]*User)
+	w.attributes = make(map[AttributeKey]posbus.StringAnyMap)
+}
+
+// Handle updates the model with an incoming message.
+// Signature matches pbc.Client.OnAny.
+func (w *World) Handle(msg posbus.Message) {
+	w.mu.Lock()
+	changes := w.apply(msg)
+	w.mu.Unlock()
+	for _, c := range changes {
+		w.listeners.Emit(c)
+	}
+}
+
+// Caller must hold the (write) lock.
+func (w *World) apply(msg posbus.Message) []Change {
+	var changes []Change
+	switch m := msg.(type) {
+	case *posbus.SetWorld:
+		if m.ID != w.info.ID {
+			w.reset(*m)
+		} else {
+			w.info = *m
+		}
+		changes = append(changes, Change{Type: WorldChanged, ID: m.ID})
+	case *posbus.AddObjects:
+		for _, def := range m.Objects {
+			def := def
+			if o, ok := w.objects[def.ID]; ok {
+				w.unlinkChild(o.ParentID, def.ID)
+				changes = append(changes, Change{Type: ObjectChanged, ID: def.ID})
+			} else {
+				changes = append(changes, Change{Type: ObjectAdded, ID: def.ID})
+			}
+			w.objects[def.ID] = &def
+			w.linkChild(def.ParentID, def.ID)
+		}
+	case *posbus.RemoveObjects:
+		removed := make(map[umid.UMID]struct{}, len(m.Objects))
+		for _, id := range m.Objects {
+			removed[id] = struct{}{}
+			if o, ok := w.objects[id]; ok {
+				w.unlinkChild(o.ParentID, id)
+				delete(w.objects, id)
+				delete(w.data, id)
+				changes = append(changes, Change{Type: ObjectRemoved, ID: id})
+			}
+		}
+		// The server does not remove their attributes separately.
+		for key := range w.attributes {
+			if _, ok := removed[key.TargetID]; ok {
+				delete(w.attributes, key)
+			}
+		}
+	case *posbus.ObjectTransform:
+		if o, ok := w.objects[m.ID]; ok {
+			o.Transform = m.Transform
+			changes = append(changes, Change{Type: ObjectMoved, ID: m.ID})
+		}
+	case *posbus.ObjectData:
+		// Can arrive before the object definition, so kept separately.
+		data, ok := w.data[m.ID]
+		if !ok {
+			data = make(map[entry.SlotType]posbus.StringAnyMap)
+			w.data[m.ID] = data
+		}
+		// Only the changed values are send, merge them.
+		for slot, values := range m.Entries {
+			if values == nil {
+				continue
+			}
+			d, ok := data[slot]
+			if !ok {
+				d = make(posbus.StringAnyMap, len(*values))
+				data[slot] = d
+			}
+			for k, v := range *values {
+				d[k] = v
+			}
+		}
+		changes = append(changes, Change{Type: ObjectDataChanged, ID: m.ID})
+	case *posbus.AddUsers:
+		for _, u := range m.Users {
+			w.users[u.ID] = &User{UserData: u}
+			changes = append(changes, Change{Type: UserAdded, ID: u.ID})
+		}
+	case *posbus.RemoveUsers:
+		for _, id := range m.Users {
+			if _, ok := w.users[id]; ok {
+				delete(w.users, id)
+				changes = append(changes, Change{Type: UserRemoved, ID: id})
+			}
+		}
+	case *posbus.UsersTransformList:
+		for _, ut := range m.Value {
+			if u, ok := w.users[ut.ID]; ok {
+				u.Transform = ut.Transform
+				changes = append(changes, Change{Type: UserMoved, ID: ut.ID})
+			}
+		}
+	case *posbus.MyTransform:
+		if u, ok := w.users[w.self]; ok {
+			u.Transform = cmath.TransformNoScale(*m)
+			changes = append(changes, Change{Type: UserMoved, ID: w.self})
+		}
+	case *posbus.AttributeValueChanged:
+		key := AttributeKey{TargetID: m.TargetID, PluginID: m.PluginID, Name: m.AttributeName}
+		if posbus.AttributeChangeType(m.ChangeType) == posbus.RemovedAttributeChangeType {
+			delete(w.attributes, key)
+			changes = append(changes, Change{Type: AttributeRemoved, ID: m.TargetID, Attribute: key})
+		} else {
+			var v posbus.StringAnyMap
+			if m.Value != nil {
+				v = *m.Value
+			}
+			w.attributes[key] = v
+			changes = append(changes, Change{Type: AttributeChanged, ID: m.TargetID, Attribute: key})
+		}
+	}
+	return changes
+}
+
+// Caller must hold the (write) lock.
+func (w *World) linkChild(parent, child umid.UMID) {
+	c, ok := w.children[parent]
+	if !ok {
+		c = make(map[umid.UMID]struct{})
+		w.children[parent] = c
+	}
+	c[child] = struct{}{}
+}
+
+// Caller must hold the (write) lock.
+func (w *World) unlinkChild(parent, child umid.UMID) {
+	if c, ok := w.children[parent]; ok {
+		delete(c, child)
+		if len(c) == 0 {
+			delete(w.children, parent)
+		}
+	}
+}
+
+// Info returns the definition of the current world.
+// The ID is nil when not in a world.
+func (w *World) Info() posbus.SetWorld {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.info
+}
+
+// Object returns the object with the given ID.
+func (w *World) Object(id umid.UMID) (Object, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if _, ok := w.objects[id]; !ok {
+		return Object{}, false
+	}
+	return w.object(id), true
+}
+
+// Objects returns all objects in the world.
+func (w *World) Objects() []Object {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	objects := make([]Object, 0, len(w.objects))
+	for id := range w.objects {
+		objects = append(objects, w.object(id))
+	}
+	return objects
+}
+
+// Children returns the objects that have the given object as parent.
+func (w *World) Children(id umid.UMID) []Object {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	children := make([]Object, 0, len(w.children[id]))
+	for cID := range w.children[id] {
+		if _, ok := w.objects[cID]; ok {
+			children = append(children, w.object(cID))
+		}
+	}
+	return children
+}
+
+// User returns the user with the given ID.
+func (w *World) User(id umid.UMID) (User, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	u, ok := w.users[id]
+	if !ok {
+		return User{}, false
+	}
+	return *u, true
+}
+
+// Users returns all users in the world, including the user of the client itself.
+func (w *World) Users() []User {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	users := make([]User, 0, len(w.users))
+	for _, u := range w.users {
+		users = append(users, *u)
+	}
+	return users
+}
+
+// Attribute returns the value of an attribute, as last received.
+func (w *World) Attribute(targetID, pluginID umid.UMID, name string) (posbus.StringAnyMap, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	v, ok := w.attributes[AttributeKey{TargetID: targetID, PluginID: pluginID, Name: name}]
+	return v, ok
+}
+
+// Copy of an object and its data.
+// Caller must hold the (read) lock.
+func (w *World) object(id umid.UMID) Object {
+	o := Object{ObjectDefinition: *w.objects[id]}
+	if data, ok := w.data[id]; ok {
+		o.Data = make(map[entry.SlotType]posbus.StringAnyMap, len(data))
+		for slot, d := range data {
+			o.Data[slot] = copyMap(d)
+		}
+	}
+	return o
+}
+
+func copyMap(m posbus.StringAnyMap) posbus.StringAnyMap {
+	c := make(posbus.StringAnyMap, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,141 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/cmath"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/types/entry"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorldObjects(t *testing.T) {
+	worldID, parentID, childID := umid.New(), umid.New(), umid.New()
+	w := New(umid.New())
+	var changes []Change
+	w.Subscribe(func(c Change) { changes = append(changes, c) })
+
+	w.Handle(&posbus.SetWorld{ID: worldID, Name: "test"})
+	w.Handle(&posbus.AddObjects{Objects: []posbus.ObjectDefinition{
+		{ID: parentID, ParentID: worldID, Name: "parent"},
+		{ID: childID, ParentID: parentID, Name: "child"},
+	}})
+	assert.Equal(t, "test", w.Info().Name)
+	assert.Len(t, w.Objects(), 2)
+	children := w.Children(parentID)
+	require.Len(t, children, 1)
+	assert.Equal(t, "child", children[0].Name)
+
+	moved := cmath.Transform{Position: cmath.Vec3{X: 1}}
+	w.Handle(&posbus.ObjectTransform{ID: childID, Transform: moved})
+	o, ok := w.Object(childID)
+	require.True(t, ok)
+	assert.Equal(t, moved, o.Transform)
+
+	w.Handle(&posbus.RemoveObjects{Objects: []umid.UMID{childID}})
+	_, ok = w.Object(childID)
+	assert.False(t, ok)
+	assert.Empty(t, w.Children(parentID))
+
+	assert.Equal(t, []ChangeType{WorldChanged, ObjectAdded, ObjectAdded, ObjectMoved, ObjectRemoved}, changeTypes(changes))
+
+	// Entering another world starts over.
+	w.Handle(&posbus.SetWorld{ID: umid.New()})
+	assert.Empty(t, w.Objects())
+}
+
+func TestWorldObjectData(t *testing.T) {
+	id := umid.New()
+	w := New(umid.New())
+	// Data can be send before the object itself.
+	w.Handle(&posbus.ObjectData{ID: id, Entries: map[entry.SlotType]*posbus.StringAnyMap{
+		entry.SlotTypeTexture: {"a": "1", "b": "2"},
+	}})
+	_, ok := w.Object(id)
+	assert.False(t, ok)
+
+	w.Handle(&posbus.AddObjects{Objects: []posbus.ObjectDefinition{{ID: id}}})
+	w.Handle(&posbus.ObjectData{ID: id, Entries: map[entry.SlotType]*posbus.StringAnyMap{
+		entry.SlotTypeTexture: {"b": "3"},
+	}})
+	o, ok := w.Object(id)
+	require.True(t, ok)
+	assert.Equal(t, posbus.StringAnyMap{"a": "1", "b": "3"}, o.Data[entry.SlotTypeTexture])
+
+	// Returned data is a copy.
+	o.Data[entry.SlotTypeTexture]["a"] = "changed"
+	o, _ = w.Object(id)
+	assert.Equal(t, "1", o.Data[entry.SlotTypeTexture]["a"])
+}
+
+func TestWorldUsers(t *testing.T) {
+	self, other := umid.New(), umid.New()
+	w := New(self)
+	w.Handle(&posbus.AddUsers{Users: []posbus.UserData{{ID: self}, {ID: other, Name: "other"}}})
+	assert.Len(t, w.Users(), 2)
+
+	pos := cmath.TransformNoScale{Position: cmath.Vec3{Y: 2}}
+	w.Handle(&posbus.UsersTransformList{Value: []posbus.UserTransform{{ID: other, Transform: pos}}})
+	u, ok := w.User(other)
+	require.True(t, ok)
+	assert.Equal(t, pos, u.Transform)
+
+	myPos := cmath.TransformNoScale{Position: cmath.Vec3{Z: 3}}
+	w.Handle((*posbus.MyTransform)(&myPos))
+	u, _ = w.User(self)
+	assert.Equal(t, myPos, u.Transform)
+
+	w.Handle(&posbus.RemoveUsers{Users: []umid.UMID{other}})
+	_, ok = w.User(other)
+	assert.False(t, ok)
+}
+
+func TestWorldAttributes(t *testing.T) {
+	target, plugin := umid.New(), umid.New()
+	w := New(umid.New())
+	w.Handle(&posbus.AttributeValueChanged{
+		TargetID: target, PluginID: plugin, AttributeName: "name",
+		ChangeType: string(posbus.ChangedAttributeChangeType),
+		Value:      &posbus.StringAnyMap{"value": "x"},
+	})
+	v, ok := w.Attribute(target, plugin, "name")
+	require.True(t, ok)
+	assert.Equal(t, "x", v["value"])
+
+	w.Handle(&posbus.AttributeValueChanged{
+		TargetID: target, PluginID: plugin, AttributeName: "name",
+		ChangeType: string(posbus.RemovedAttributeChangeType),
+	})
+	_, ok = w.Attribute(target, plugin, "name")
+	assert.False(t, ok)
+}
+
+func TestWorldRemoveObjectAttributes(t *testing.T) {
+	removed, kept, plugin := umid.New(), umid.New(), umid.New()
+	w := New(umid.New())
+	w.Handle(&posbus.AddObjects{Objects: []posbus.ObjectDefinition{{ID: removed}, {ID: kept}}})
+	for _, id := range []umid.UMID{removed, kept} {
+		w.Handle(&posbus.AttributeValueChanged{
+			TargetID: id, PluginID: plugin, AttributeName: "name",
+			ChangeType: string(posbus.ChangedAttributeChangeType),
+			Value:      &posbus.StringAnyMap{"value": "x"},
+		})
+	}
+
+	w.Handle(&posbus.RemoveObjects{Objects: []umid.UMID{removed}})
+	_, ok := w.Attribute(removed, plugin, "name")
+	assert.False(t, ok)
+	_, ok = w.Attribute(kept, plugin, "name")
+	assert.True(t, ok)
+	assert.Len(t, w.attributes, 1)
+}
+
+func changeTypes(changes []Change) []ChangeType {
+	types := make([]ChangeType, len(changes))
+	for i, c := range changes {
+		types[i] = c.Type
+	}
+	return types
+}
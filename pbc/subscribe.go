@@ -0,0 +1,137 @@
+package pbc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+)
+
+// SlowConsumerPolicy determines what happens to a message for a subscriber that has a full buffer.
+type SlowConsumerPolicy int
+
+const (
+	// Wait until the subscriber reads, this holds up all other handlers (and reading from the connection).
+	SlowConsumerBlock SlowConsumerPolicy = iota
+	// Drop the oldest buffered message to make room.
+	SlowConsumerDropOldest
+	// Drop the new message.
+	SlowConsumerDropNewest
+	// Close the subscription.
+	SlowConsumerClose
+)
+
+// SubscribeOptions configures a subscription, see SubscribeWith.
+type SubscribeOptions struct {
+	// Number of messages buffered for the subscriber.
+	Buffer int
+	// What to do when the buffer is full.
+	Policy SlowConsumerPolicy
+}
+
+// Default options of Subscribe.
+var DefaultSubscribeOptions = SubscribeOptions{
+	Buffer: 256,
+	Policy: SlowConsumerBlock,
+}
+
+// Subscribe returns a channel that receives the incoming messages of the given types,
+// or all messages when no types are given.
+// The channel is closed when the context is done or the client is closed (or failed).
+// Uses DefaultSubscribeOptions.
+func (c *Client) Subscribe(ctx context.Context, filter ...posbus.MsgType) <-chan posbus.Message {
+	return c.SubscribeWith(ctx, DefaultSubscribeOptions, filter...)
+}
+
+// SubscribeWith is Subscribe with the given buffer size and slow consumer policy.
+func (c *Client) SubscribeWith(ctx context.Context, opts SubscribeOptions, filter ...posbus.MsgType) <-chan posbus.Message {
+	s := &subscription{
+		ch:     make(chan posbus.Message, opts.Buffer),
+		done:   make(chan struct{}),
+		policy: opts.Policy,
+	}
+	var unsubscribes []func()
+	if len(filter) == 0 {
+		unsubscribes = append(unsubscribes, c.OnAny(s.deliver))
+	}
+	for _, t := range filter {
+		unsubscribes = append(unsubscribes, c.handlers.forType(t).Add(s.deliver))
+	}
+	unsubscribes = append(unsubscribes, c.OnStateChange(func(sc StateChange) {
+		if sc.To.IsTerminal() {
+			s.stop()
+		}
+	}))
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.done:
+		}
+		for _, unsubscribe := range unsubscribes {
+			unsubscribe()
+		}
+		s.close()
+	}()
+	return s.ch
+}
+
+type subscription struct {
+	// Guards sending on, and closing, the channel.
+	mu     sync.Mutex
+	ch     chan posbus.Message
+	closed bool
+	// Closed when the subscription should end.
+	done     chan struct{}
+	stopOnce sync.Once
+	policy   SlowConsumerPolicy
+}
+
+func (s *subscription) deliver(msg posbus.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case <-s.done:
+		return
+	case s.ch <- msg:
+		return
+	default:
+	}
+	switch s.policy {
+	case SlowConsumerBlock:
+		select {
+		case s.ch <- msg:
+		case <-s.done:
+		}
+	case SlowConsumerDropOldest:
+		select {
+		case <-s.ch:
+		default:
+		}
+		select {
+		case s.ch <- msg:
+		default:
+		}
+	case SlowConsumerClose:
+		s.stop()
+	}
+}
+
+// Signal the subscription to end.
+func (s *subscription) stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *subscription) close() {
+	s.stop()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
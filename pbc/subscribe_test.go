@@ -0,0 +1,61 @@
+package pbc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscribe(t *testing.T) {
+	c := NewClient()
+	c.SetCallback(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	all := c.Subscribe(ctx)
+	worlds := c.Subscribe(context.Background(), posbus.TypeSetWorld)
+
+	c.dispatch(&posbus.AddUsers{})
+	c.dispatch(&posbus.SetWorld{Name: "a"})
+	assert.IsType(t, &posbus.AddUsers{}, <-all)
+	assert.IsType(t, &posbus.SetWorld{}, <-all)
+	assert.Equal(t, "a", (<-worlds).(*posbus.SetWorld).Name)
+
+	// Closed on unsubscribe.
+	cancel()
+	assertClosed(t, all)
+
+	// Closed on shutdown of the client.
+	c.setState(StateConnected, nil)
+	c.setState(StateClosed, nil)
+	assertClosed(t, worlds)
+}
+
+func TestSubscribeSlowConsumer(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient()
+	c.SetCallback(nil)
+	dropOldest := c.SubscribeWith(ctx, SubscribeOptions{Buffer: 1, Policy: SlowConsumerDropOldest})
+	dropNewest := c.SubscribeWith(ctx, SubscribeOptions{Buffer: 1, Policy: SlowConsumerDropNewest})
+	closing := c.SubscribeWith(ctx, SubscribeOptions{Buffer: 1, Policy: SlowConsumerClose})
+
+	c.dispatch(&posbus.SetWorld{Name: "a"})
+	c.dispatch(&posbus.SetWorld{Name: "b"})
+
+	assert.Equal(t, "b", (<-dropOldest).(*posbus.SetWorld).Name)
+	assert.Equal(t, "a", (<-dropNewest).(*posbus.SetWorld).Name)
+	assert.Equal(t, "a", (<-closing).(*posbus.SetWorld).Name)
+	assertClosed(t, closing)
+}
+
+func assertClosed(t *testing.T, ch <-chan posbus.Message) {
+	t.Helper()
+	select {
+	case _, ok := <-ch:
+		require.False(t, ok, "channel closed")
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed")
+	}
+}
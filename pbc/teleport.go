@@ -0,0 +1,91 @@
+package pbc
+
+import (
+	"context"
+	"time"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Maximum time to wait for a world to load after teleporting.
+const teleportTimeout = 30 * time.Second
+
+var (
+	// Teleported to a world that does not exist.
+	ErrWorldDoesNotExist = errors.New("PBC: world does not exist")
+	// The world did not load in time.
+	ErrTeleportTimeout = errors.New("PBC: teleport timeout")
+)
+
+// WorldSummary describes the world after teleporting to it.
+type WorldSummary struct {
+	posbus.SetWorld
+	// Number of objects in the world.
+	Objects int
+	// Number of users in the world, including the user of the client.
+	Users int
+	// Time between sending the teleport and the world being loaded.
+	LoadTime time.Duration
+}
+
+// Teleport the user of the client to a world.
+// Blocks until the world is loaded, and returns a summary of it.
+// All messages of the world are passed to the handlers as usual.
+// Fails with ErrWorldDoesNotExist, ErrTeleportTimeout or ErrConnectionClosed when the connection is lost while loading.
+func (c *Client) Teleport(ctx context.Context, worldID umid.UMID) (*WorldSummary, error) {
+	if worldID == umid.Nil {
+		return nil, errors.Wrap(ErrInvalidArgument, "teleport to nil world")
+	}
+	ctx, span := c.startSpan(ctx, "pbc.teleport", trace.WithAttributes(attrWorldID.String(worldID.String())))
+	w := &teleportWaiter{target: worldID}
+	start := time.Now()
+	err := c.request(ctx, &posbus.TeleportRequest{Target: worldID}, teleportTimeout, ErrTeleportTimeout, w.handle)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	w.summary.LoadTime = time.Since(start)
+	span.SetAttributes(attribute.Int("pbc.objects", w.summary.Objects), attribute.Int("pbc.users", w.summary.Users))
+	span.End()
+	c.log.Debugf("PBC: teleported to %s in %s", worldID, w.summary.LoadTime)
+	return &w.summary, nil
+}
+
+// Follows the incoming messages, until the world is loaded.
+type teleportWaiter struct {
+	target  umid.UMID
+	started bool
+	summary WorldSummary
+}
+
+func (w *teleportWaiter) handle(msg posbus.Message) (bool, error) {
+	switch m := msg.(type) {
+	case *posbus.Signal:
+		if m.Value == posbus.SignalWorldDoesNotExist && !w.started {
+			return true, ErrWorldDoesNotExist
+		}
+	case *posbus.SetWorld:
+		if m.ID == w.target {
+			w.started = true
+			w.summary.SetWorld = *m
+		}
+	case *posbus.AddObjects:
+		if w.started {
+			w.summary.Objects += len(m.Objects)
+		}
+	case *posbus.AddUsers:
+		if w.started {
+			w.summary.Users += len(m.Users)
+		}
+	case *posbus.UsersTransformList:
+		// Send periodically once in a world, after the initial world data.
+		if w.started {
+			return true, nil
+		}
+	}
+	return false, nil
+}
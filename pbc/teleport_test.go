@@ -0,0 +1,48 @@
+package pbc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTeleportValidation(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient()
+	_, err := c.Teleport(ctx, umid.Nil)
+	assert.ErrorIs(t, err, ErrInvalidArgument)
+	_, err = c.Teleport(ctx, umid.New())
+	assert.ErrorIs(t, err, ErrNotConnected)
+}
+
+func TestTeleportWaiter(t *testing.T) {
+	world := umid.New()
+
+	w := &teleportWaiter{target: world}
+	for _, msg := range []posbus.Message{
+		&posbus.SetWorld{ID: world, Name: "test"},
+		&posbus.AddObjects{Objects: make([]posbus.ObjectDefinition, 2)},
+		&posbus.AddObjects{Objects: make([]posbus.ObjectDefinition, 3)},
+		&posbus.AddUsers{Users: make([]posbus.UserData, 1)},
+	} {
+		done, _ := w.handle(msg)
+		require.False(t, done)
+	}
+	done, err := w.handle(&posbus.UsersTransformList{})
+	require.True(t, done)
+	require.NoError(t, err)
+	assert.Equal(t, "test", w.summary.Name)
+	assert.Equal(t, 5, w.summary.Objects)
+	assert.Equal(t, 1, w.summary.Users)
+
+	w = &teleportWaiter{target: world}
+	done, _ = w.handle(&posbus.UsersTransformList{}) // from the previous world
+	assert.False(t, done)
+	done, err = w.handle(&posbus.Signal{Value: posbus.SignalWorldDoesNotExist})
+	assert.True(t, done)
+	assert.ErrorIs(t, err, ErrWorldDoesNotExist)
+}
@@ -0,0 +1,150 @@
+package pbc
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Time before the token expires to get a new one.
+	tokenRefreshMargin = time.Minute
+	// Maximum time for the token provider to come up with a token.
+	tokenProviderTimeout = 30 * time.Second
+	// Connections in a row that are closed before the server sent anything,
+	// before giving up on the handshake being accepted.
+	maxRejectedHandshakes = 3
+	// A rejected handshake is closed right away, a connection closed later was accepted.
+	handshakeTimeout = 10 * time.Second
+)
+
+var (
+	// The server did not accept the handshake, e.g. because of an invalid token.
+	ErrAuthFailed = errors.New("PBC: authentication failed")
+	// The token has expired, and there is no TokenProvider to get a new one.
+	ErrTokenExpired = errors.New("PBC: token expired")
+)
+
+// TokenProvider returns a (new) token for the user of the client, see WithTokenProvider.
+// It should return a token of the same user, the user ID of the client does not change.
+type TokenProvider func(ctx context.Context) (string, error)
+
+// TokenExpiry returns the time a JWT token expires (its exp claim).
+// Zero when it does not expire or is not a JWT. The signature is not verified, that is up to the server.
+func TokenExpiry(token string) time.Time {
+	var claims jwt.StandardClaims
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, &claims); err != nil || claims.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.ExpiresAt, 0)
+}
+
+func tokenExpired(token string) bool {
+	exp := TokenExpiry(token)
+	return !exp.IsZero() && !time.Now().Before(exp)
+}
+
+// Current token, as send in the handshake.
+func (c *Client) token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hs.Token
+}
+
+// Get a new token from the provider.
+func (c *Client) refreshToken(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, tokenProviderTimeout)
+	defer cancel()
+	token, err := c.tokenProvider(ctx)
+	if err != nil {
+		return errors.WithMessage(err, "PBC: token provider")
+	}
+	c.log.Debugf("PBC: new token, expires %s", TokenExpiry(token))
+	return c.SetToken(token)
+}
+
+// Make sure there is a valid token before reconnecting.
+// Fails with ErrAuthFailed when it has expired and there is no way to get a new one.
+func (c *Client) renewToken(ctx context.Context) error {
+	if c.tokenProvider == nil {
+		if tokenExpired(c.token()) {
+			return fmt.Errorf("%w: %w", ErrAuthFailed, ErrTokenExpired)
+		}
+		return nil
+	}
+	err := c.refreshToken(ctx)
+	if err != nil && !tokenExpired(c.token()) {
+		// Try the old one.
+		c.log.Warn(err)
+		return nil
+	}
+	return err
+}
+
+// Get a new token from the provider just before the current one expires.
+// It is used for the next handshake, so the client can reconnect without waiting for the provider.
+func (c *Client) scheduleTokenRefresh(token string) {
+	if c.tokenProvider == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokenTimer != nil {
+		c.tokenTimer.Stop()
+		c.tokenTimer = nil
+	}
+	ctx := c.clientCtx
+	exp := TokenExpiry(token)
+	if ctx == nil || exp.IsZero() {
+		return
+	}
+	d := time.Until(exp) - tokenRefreshMargin
+	if d <= 0 {
+		// Too late already, renewed on reconnect.
+		return
+	}
+	c.tokenTimer = time.AfterFunc(d, func() {
+		if ctx.Err() != nil || c.State().IsTerminal() {
+			return
+		}
+		if err := c.refreshToken(ctx); err != nil {
+			c.log.Warn(err)
+		}
+	})
+}
+
+// Stop refreshing the token.
+func (c *Client) stopTokenRefresh() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokenTimer != nil {
+		c.tokenTimer.Stop()
+		c.tokenTimer = nil
+	}
+}
+
+// What happened on a connection, to tell if its handshake was rejected.
+type connStats struct {
+	start    time.Time
+	received int
+	ponged   atomic.Bool
+}
+
+// Count connections that are closed before the server sent anything, returns true after a few in a row to give up.
+// The server does not respond to a rejected handshake, it just stops handling the connection:
+// it closes it right away or leaves it open without reading, so the first ping is not answered.
+// A connection that was up longer than the handshake timeout, got a message or a pong was accepted.
+func (c *Client) handshakeRejected(stats *connStats, closeReason string, cause error) bool {
+	closed := closeReason == "server" && time.Since(stats.start) < c.handshakeTimeout
+	if stats.received > 0 || stats.ponged.Load() || (!closed && !errors.Is(cause, ErrPongTimeout)) {
+		c.rejectedHandshakes.Store(0)
+		return false
+	}
+	n := c.rejectedHandshakes.Add(1)
+	c.log.Infof("PBC: connection closed before receiving anything (%d in a row)", n)
+	return n >= maxRejectedHandshakes
+}
@@ -0,0 +1,182 @@
+package pbc_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/momentum-xyz/posbus-client/pbc"
+	"github.com/momentum-xyz/posbus-client/pbc/pbctest"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testToken(t *testing.T, exp time.Time) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
+		Subject:   umid.New().String(),
+		ExpiresAt: exp.Unix(),
+	}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	return token
+}
+
+// Records the state changes of a client.
+func stateChanges(c *pbc.Client) func() []pbc.StateChange {
+	var mu sync.Mutex
+	var changes []pbc.StateChange
+	c.OnStateChange(func(sc pbc.StateChange) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, sc)
+	})
+	return func() []pbc.StateChange {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]pbc.StateChange(nil), changes...)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	assert.Equal(t, exp, pbc.TokenExpiry(testToken(t, exp)))
+	assert.Zero(t, pbc.TokenExpiry("token"))
+	assert.Zero(t, pbc.TokenExpiry(testToken(t, time.Unix(0, 0))))
+}
+
+func TestClientAuthFailed(t *testing.T) {
+	srv := pbctest.NewServer(t)
+	srv.Authenticate = func(posbus.HandShake) bool { return false }
+	c := pbc.NewClient(pbc.WithTransport(srv.Transport()), pbc.WithReconnectPolicy(fastRetry))
+	c.SetCallback(nil)
+	changes := stateChanges(c)
+	require.NoError(t, c.Connect(context.Background(), srv.URL, "invalid", umid.New()))
+	defer c.Close()
+
+	waitState(t, c, pbc.StateAuthFailed)
+	last := changes()[len(changes())-1]
+	assert.ErrorIs(t, last.Cause, pbc.ErrAuthFailed)
+	assert.ErrorIs(t, c.SendMessage(context.Background(), &posbus.HighFive{}), pbc.ErrNotConnected)
+}
+
+func TestClientTokenExpired(t *testing.T) {
+	srv := pbctest.NewServer(t)
+	c := pbc.NewClient(pbc.WithTransport(srv.Transport()), pbc.WithReconnectPolicy(fastRetry))
+	c.SetCallback(nil)
+	changes := stateChanges(c)
+	require.NoError(t, c.Connect(context.Background(), srv.URL, testToken(t, time.Now().Add(-time.Second)), umid.New()))
+	defer c.Close()
+
+	// Only checked when reconnecting, the server decides for the first connection.
+	srv.NextConn().Drop()
+	waitState(t, c, pbc.StateAuthFailed)
+	last := changes()[len(changes())-1]
+	assert.ErrorIs(t, last.Cause, pbc.ErrTokenExpired)
+}
+
+func TestClientTokenProvider(t *testing.T) {
+	ctx := context.Background()
+	srv := pbctest.NewServer(t)
+	var rejected atomic.Value
+	rejected.Store("")
+	var rejections atomic.Int32
+	srv.Authenticate = func(hs posbus.HandShake) bool {
+		if hs.Token == rejected.Load() {
+			rejections.Add(1)
+			return false
+		}
+		return true
+	}
+
+	tokens := make(chan string, 10)
+	provider := func(ctx context.Context) (string, error) {
+		select {
+		case token := <-tokens:
+			return token, nil
+		default:
+			return "", errors.New("no more tokens")
+		}
+	}
+	c := pbc.NewClient(pbc.WithTransport(srv.Transport()), pbc.WithReconnectPolicy(fastRetry), pbc.WithTokenProvider(provider))
+	c.SetCallback(nil)
+
+	// The first one from the provider.
+	first := testToken(t, time.Now().Add(time.Hour))
+	tokens <- first
+	require.NoError(t, c.Connect(ctx, srv.URL, "", umid.New()))
+	defer c.Close()
+	conn := srv.NextConn()
+	assert.Equal(t, first, conn.Handshake.Token)
+
+	// A new one for every reconnect.
+	rejected.Store(first)
+	tokens <- "second"
+	conn.Drop()
+	conn = srv.NextConn()
+	assert.Equal(t, "second", conn.Handshake.Token)
+	waitState(t, c, pbc.StateConnected)
+	// Accepted, for sure.
+	conn.Send(&posbus.UsersTransformList{})
+
+	// Refreshed a minute before it expires, the next handshake uses it.
+	require.NoError(t, c.SetToken(testToken(t, time.Now().Add(time.Minute+2*time.Second))))
+	tokens <- "third"
+	require.Eventually(t, func() bool { return len(tokens) == 0 }, 2*pbctest.Timeout, 10*time.Millisecond)
+
+	// Without a new token, the old one is tried until the server rejected it a few times.
+	rejected.Store("third")
+	rejections.Store(0)
+	conn.Drop()
+	waitState(t, c, pbc.StateAuthFailed)
+	assert.EqualValues(t, 3, rejections.Load())
+}
+
+func TestClientIdleClose(t *testing.T) {
+	srv := pbctest.NewServer(t)
+	c := pbc.NewClient(pbc.WithTransport(srv.Transport()), pbc.WithReconnectPolicy(fastRetry))
+	pbc.SetHandshakeTimeout(c, 10*time.Millisecond)
+	c.SetCallback(nil)
+	require.NoError(t, c.Connect(context.Background(), srv.URL, "token", umid.New()))
+	defer c.Close()
+
+	// Closed by the server without sending anything, but after the handshake was accepted.
+	for i := 0; i < 5; i++ {
+		conn := srv.NextConn()
+		waitState(t, c, pbc.StateConnected)
+		time.Sleep(20 * time.Millisecond)
+		conn.Drop()
+	}
+	srv.NextConn()
+	waitState(t, c, pbc.StateConnected)
+}
+
+func TestClientSetTokenReconnecting(t *testing.T) {
+	srv := pbctest.NewServer(t)
+	c, conn := connect(t, srv, srv.Transport())
+
+	// Like a refresh by the timer, while the handshake is written.
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				c.SetToken("refreshed")
+			}
+		}
+	}()
+	conn.Drop()
+	conn = srv.NextConn()
+	close(stop)
+	<-done
+	conn.Send(&posbus.UsersTransformList{})
+	waitState(t, c, pbc.StateConnected)
+}
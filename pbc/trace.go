@@ -0,0 +1,42 @@
+package pbc
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the tracer, see WithTracerProvider.
+const tracerName = "github.com/momentum-xyz/posbus-client/pbc"
+
+// Attributes of the spans.
+const (
+	attrSessionID   = attribute.Key("pbc.session_id")
+	attrUserID      = attribute.Key("pbc.user_id")
+	attrWorldID     = attribute.Key("pbc.world_id")
+	attrObjectID    = attribute.Key("pbc.object_id")
+	attrAttempt     = attribute.Key("pbc.attempt")
+	attrCloseReason = attribute.Key("pbc.close_reason")
+	attrCause       = attribute.Key("pbc.cause")
+)
+
+// Start a span, with the session of the client.
+// The session ID is sent in the handshake, to correlate with the traces of the controller.
+func (c *Client) startSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	c.mu.Lock()
+	session, user := c.hs.SessionId, c.hs.UserId
+	c.mu.Unlock()
+	opts = append(opts, trace.WithAttributes(attrSessionID.String(session.String()), attrUserID.String(user.String())))
+	return c.tracer.Start(ctx, name, opts...)
+}
+
+// End a span, with the error if it failed.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
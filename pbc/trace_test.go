@@ -0,0 +1,107 @@
+package pbc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/momentum-xyz/posbus-client/pbc"
+	"github.com/momentum-xyz/posbus-client/pbc/pbctest"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttrs(s tracetest.SpanStub) map[attribute.Key]string {
+	m := make(map[attribute.Key]string)
+	for _, kv := range s.Attributes {
+		m[kv.Key] = kv.Value.Emit()
+	}
+	return m
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, s := range spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	require.Failf(t, "no span", "%s in %d spans", name, len(spans))
+	return tracetest.SpanStub{}
+}
+
+func TestClientTracing(t *testing.T) {
+	ctx := context.Background()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	world := posbus.SetWorld{ID: umid.New()}
+	srv, _ := worldServer(t, world, make([]posbus.ObjectDefinition, 2))
+	srv.Handle(posbus.TypeLockObject, func(c *pbctest.Conn, msg posbus.Message) {
+		c.Send(&posbus.LockObjectResponse{ID: msg.(*posbus.LockObject).ID, Result: 1, LockOwner: c.Handshake.UserId})
+	})
+	c := pbc.NewClient(pbc.WithTransport(srv.Transport()), pbc.WithReconnectPolicy(fastRetry), pbc.WithTracerProvider(tp))
+	c.SetCallback(nil)
+	require.NoError(t, c.Connect(ctx, srv.URL, "token", umid.New()))
+	defer c.Close()
+	conn := srv.NextConn()
+	session := conn.Handshake.SessionId.String()
+
+	_, err := c.Teleport(ctx, world.ID)
+	require.NoError(t, err)
+	_, err = c.Teleport(ctx, umid.New())
+	require.ErrorIs(t, err, pbc.ErrWorldDoesNotExist)
+	object := umid.New()
+	_, err = c.LockObject(ctx, object)
+	require.NoError(t, err)
+
+	conn.Drop()
+	srv.NextConn()
+	waitState(t, c, pbc.StateConnected)
+	require.Eventually(t, func() bool {
+		for _, s := range exporter.GetSpans() {
+			if s.Name == "pbc.reconnect" {
+				return true
+			}
+		}
+		return false
+	}, pbctest.Timeout, time.Millisecond)
+	spans := exporter.GetSpans()
+
+	connect := findSpan(t, spans, "pbc.connect")
+	assert.Equal(t, session, spanAttrs(connect)["pbc.session_id"])
+	for _, name := range []string{"pbc.dial", "pbc.handshake"} {
+		assert.Equal(t, connect.SpanContext.SpanID(), findSpan(t, spans, name).Parent.SpanID(), name)
+	}
+
+	var teleports []tracetest.SpanStub
+	for _, s := range spans {
+		if s.Name == "pbc.teleport" {
+			teleports = append(teleports, s)
+		}
+	}
+	require.Len(t, teleports, 2)
+	attrs := spanAttrs(teleports[0])
+	assert.Equal(t, world.ID.String(), attrs["pbc.world_id"])
+	assert.Equal(t, session, attrs["pbc.session_id"])
+	assert.Equal(t, "2", attrs["pbc.objects"])
+	assert.Equal(t, codes.Unset, teleports[0].Status.Code)
+	assert.Equal(t, codes.Error, teleports[1].Status.Code)
+
+	lock := findSpan(t, spans, "pbc.lock")
+	assert.Equal(t, object.String(), spanAttrs(lock)["pbc.object_id"])
+	assert.Equal(t, "true", spanAttrs(lock)["pbc.locked"])
+
+	reconnect := findSpan(t, spans, "pbc.reconnect")
+	// A dropped connection looks like the server closing it.
+	assert.Equal(t, "server", spanAttrs(reconnect)["pbc.close_reason"])
+	assert.False(t, reconnect.Parent.IsValid())
+	require.Len(t, reconnect.Links, 1)
+	assert.Equal(t, connect.SpanContext.SpanID(), reconnect.Links[0].SpanContext.SpanID())
+}
@@ -0,0 +1,162 @@
+package pbc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	"nhooyr.io/websocket"
+)
+
+// Transport sets up connections to a posbus server.
+type Transport interface {
+	// Dial connects to the server at the URL.
+	Dial(ctx context.Context, url string) (Conn, error)
+}
+
+// Conn is a connection that carries binary posbus messages.
+type Conn interface {
+	// Read the next message, blocks until there is one.
+	// Returns io.EOF when the connection was closed by the other side.
+	Read(ctx context.Context) ([]byte, error)
+	// Write a message.
+	Write(ctx context.Context, msg []byte) error
+	// Close the connection, with a reason for the other side.
+	Close(reason string) error
+}
+
+// Pinger is implemented by connections that can check the other side is still there, see WithKeepalive.
+// The websocket connection does not in the browser (WASM), pings are up to the browser there.
+type Pinger interface {
+	// Ping the other side, blocks until the pong is received.
+	Ping(ctx context.Context) error
+}
+
+// A message was received that is not a posbus message, the connection can still be used.
+var ErrInvalidFrame = errors.New("PBC: invalid frame")
+
+// WebsocketTransport connects over websockets, this is the default transport.
+type WebsocketTransport struct {
+	// Options to dial with, can be nil.
+	DialOptions *websocket.DialOptions
+	// Maximum size of incoming messages, zero for the websocket default.
+	ReadLimit int64
+}
+
+func (t WebsocketTransport) Dial(ctx context.Context, url string) (Conn, error) {
+	conn, _, err := websocket.Dial(ctx, url, t.DialOptions)
+	if err != nil {
+		return nil, err
+	}
+	if t.ReadLimit > 0 {
+		conn.SetReadLimit(t.ReadLimit)
+	}
+	return &websocketConn{conn: conn}, nil
+}
+
+type websocketConn struct {
+	conn *websocket.Conn
+}
+
+func (c *websocketConn) Read(ctx context.Context) ([]byte, error) {
+	messageType, msg, err := c.conn.Read(ctx)
+	if err != nil {
+		if websocket.CloseStatus(err) != -1 {
+			return nil, fmt.Errorf("%w: %w", io.EOF, err)
+		}
+		return nil, err
+	}
+	if messageType != websocket.MessageBinary {
+		return nil, errors.Wrapf(ErrInvalidFrame, "websocket message type %s", messageType)
+	}
+	return msg, nil
+}
+
+func (c *websocketConn) Write(ctx context.Context, msg []byte) error {
+	return c.conn.Write(ctx, websocket.MessageBinary, msg)
+}
+
+func (c *websocketConn) Close(reason string) error {
+	return c.conn.Close(websocket.StatusNormalClosure, reason)
+}
+
+// PipeTransport connects in memory, to a server that is handed the other end of the connection.
+// For tests, or running next to a server in the same process.
+type PipeTransport struct {
+	// Called in a new goroutine for every connection, with the server end of it.
+	Serve func(conn Conn)
+}
+
+func (t PipeTransport) Dial(ctx context.Context, url string) (Conn, error) {
+	if t.Serve == nil {
+		return nil, errors.New("PBC: pipe transport without server")
+	}
+	client, server := Pipe()
+	go t.Serve(server)
+	return client, nil
+}
+
+// Size of the buffer in each direction of a pipe.
+const pipeBuffer = 64
+
+// Pipe creates an in-memory connection, messages written to one end are read from the other.
+func Pipe() (Conn, Conn) {
+	p := &pipe{closed: make(chan struct{})}
+	a, b := make(chan []byte, pipeBuffer), make(chan []byte, pipeBuffer)
+	return &pipeConn{pipe: p, in: a, out: b}, &pipeConn{pipe: p, in: b, out: a}
+}
+
+type pipe struct {
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+type pipeConn struct {
+	pipe *pipe
+	in   <-chan []byte
+	out  chan<- []byte
+}
+
+func (c *pipeConn) Read(ctx context.Context) ([]byte, error) {
+	// What was written before closing goes first.
+	select {
+	case msg := <-c.in:
+		return msg, nil
+	default:
+	}
+	select {
+	case msg := <-c.in:
+		return msg, nil
+	case <-c.pipe.closed:
+		return nil, io.EOF
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *pipeConn) Write(ctx context.Context, msg []byte) error {
+	// Caller can reuse its buffer.
+	msg = append([]byte(nil), msg...)
+	select {
+	case <-c.pipe.closed:
+		return io.ErrClosedPipe
+	default:
+	}
+	select {
+	case c.out <- msg:
+		return nil
+	case <-c.pipe.closed:
+		return io.ErrClosedPipe
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *pipeConn) Close(reason string) error {
+	c.pipe.closeOnce.Do(func() {
+		close(c.pipe.closed)
+	})
+	return nil
+}
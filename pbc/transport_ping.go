@@ -0,0 +1,11 @@
+//go:build !js
+
+package pbc
+
+import "context"
+
+// In the browser the websocket API has no pings, Ping of the websocket package returns right away there.
+// Without it the ping pump does not run, instead of measuring nothing and never noticing a dead connection.
+func (c *websocketConn) Ping(ctx context.Context) error {
+	return c.conn.Ping(ctx)
+}
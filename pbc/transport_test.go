@@ -0,0 +1,81 @@
+package pbc
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe(t *testing.T) {
+	ctx := context.Background()
+	a, b := Pipe()
+	require.NoError(t, a.Write(ctx, []byte("ping")))
+	msg, err := b.Read(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(msg))
+
+	require.NoError(t, b.Write(ctx, []byte("last")))
+	require.NoError(t, b.Close("done"))
+	msg, err = a.Read(ctx)
+	require.NoError(t, err, "written before closing")
+	assert.Equal(t, "last", string(msg))
+	_, err = a.Read(ctx)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.ErrorIs(t, a.Write(ctx, []byte("x")), io.ErrClosedPipe)
+}
+
+func TestPipeTransport(t *testing.T) {
+	ctx := context.Background()
+	handshakes := make(chan posbus.HandShake, 2)
+	first := true
+	serve := func(conn Conn) {
+		defer conn.Close("")
+		for {
+			data, err := conn.Read(ctx)
+			if err != nil {
+				return
+			}
+			msg, err := posbus.Decode(data)
+			require.NoError(t, err)
+			switch m := msg.(type) {
+			case *posbus.HandShake:
+				handshakes <- *m
+			case *posbus.TeleportRequest:
+				conn.Write(ctx, posbus.BinMessage(&posbus.SetWorld{ID: m.Target, Name: "piped"}))
+				conn.Write(ctx, posbus.BinMessage(&posbus.UsersTransformList{}))
+				if first {
+					// Drop the connection, the client should come back.
+					first = false
+					return
+				}
+			}
+		}
+	}
+	c := NewClient(
+		WithTransport(PipeTransport{Serve: serve}),
+		WithReconnectPolicy(&ExponentialBackoff{Initial: time.Millisecond, Max: time.Millisecond}),
+	)
+	c.SetCallback(nil)
+	userID := umid.New()
+	require.NoError(t, c.Connect(ctx, "pipe", "token", userID))
+	defer c.Close()
+	assert.Equal(t, userID, (<-handshakes).UserId)
+
+	world := umid.New()
+	summary, err := c.Teleport(ctx, world)
+	require.NoError(t, err)
+	assert.Equal(t, "piped", summary.Name)
+
+	select {
+	case hs := <-handshakes:
+		assert.Equal(t, userID, hs.UserId, "handshake again after reconnect")
+	case <-time.After(time.Second):
+		t.Fatal("no reconnect")
+	}
+}
@@ -93,23 +93,17 @@ func (s *ClientTestSuite) TestClient() {
 	//assert := assert.New(s.T())
 	require := require.New(s.T())
 
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
 	client := pbc.NewClient()
 	require.NotEmpty(s.T(), s.guestId)
 	require.NotEmpty(s.T(), s.guestToken)
 
-	// channel to read back messages for testing
-	ch := make(chan any, 1)
 	s.T().Cleanup(func() {
-		client.SetCallback(func(msg posbus.Message) {
-			return
-		})
+		cancel()
 		client.Close()
-		close(ch)
-	})
-	client.SetCallback(func(msg posbus.Message) {
-		ch <- msg
 	})
+	// channel to read back messages for testing
+	ch := client.Subscribe(ctx)
 
 	url := s.ctURL.JoinPath("posbus").String()
 
@@ -118,6 +112,8 @@ func (s *ClientTestSuite) TestClient() {
 		s.T().Fatalf("connection: %s", err)
 	}
 
+	require.Equal(pbc.StateConnected, client.State(), "Connected state after connect")
+
 	// Assertion on the first message
 	assertNextMsg(s.T(), ch, &posbus.Signal{}, func(sig *posbus.Signal) {
 		require.Equal(posbus.SignalConnected, sig.Value, "First message is connected signal")
@@ -125,22 +121,19 @@ func (s *ClientTestSuite) TestClient() {
 
 	// Teleport to a non existant world.
 	var nonExistantWorld = umid.MustParse("3b52cc0c-0e58-48ed-b147-f6d2d14c137b")
-	client.Send(
-		posbus.BinMessage(
-			&posbus.TeleportRequest{Target: nonExistantWorld},
-		),
-	)
+	_, err = client.Teleport(ctx, nonExistantWorld)
+	require.ErrorIs(err, pbc.ErrWorldDoesNotExist)
 
 	assertNextMsg(s.T(), ch, &posbus.Signal{}, func(sig *posbus.Signal) {
 		require.Equal(posbus.SignalWorldDoesNotExist, sig.Value, "Signal world does not exist")
 	})
 
 	// Teleport to a world.
-	client.Send(
-		posbus.BinMessage(
-			&posbus.TeleportRequest{Target: s.world.GetID()},
-		),
-	)
+	summary, err := client.Teleport(ctx, s.world.GetID())
+	require.NoError(err)
+	require.Equal(s.world.GetID(), summary.ID, "Teleported to the world")
+	require.Equal(2, summary.Objects, "World and its object")
+	require.Equal(2, summary.Users, "Guest and other user")
 
 	// Teleport should respond to set the world.
 	assertNextMsg(s.T(), ch, &posbus.SetWorld{}, func(w *posbus.SetWorld) {
@@ -231,11 +224,14 @@ func (s *ClientTestSuite) TestClient() {
 	//assert.Equal(s.T(), "foo", "bar")
 }
 
-func assertNextMsg[T any](t *testing.T, ch <-chan any, expectedType T, f func(msg T)) {
+func assertNextMsg[T any](t *testing.T, ch <-chan posbus.Message, expectedType T, f func(msg T)) {
 	t.Helper()
 	const msg1Timeout = 2 * time.Second
 	select {
-	case msg := <-ch:
+	case msg, ok := <-ch:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
 		if assert.IsType(t, expectedType, msg, "Message is not expected type") {
 			x, _ := msg.(T)
 			f(x)
@@ -1,20 +1,20 @@
 package fixtures
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"net/url"
 
 	"github.com/gorilla/websocket"
 	"github.com/hashicorp/go-retryablehttp"
 	influxWrite "github.com/influxdata/influxdb-client-go/v2/api/write"
 
+	"github.com/momentum-xyz/posbus-client/pbc/api"
+
 	"github.com/momentum-xyz/ubercontroller/pkg/cmath"
 	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
 	"github.com/momentum-xyz/ubercontroller/types/entry"
 	"github.com/momentum-xyz/ubercontroller/universe"
-	"github.com/momentum-xyz/ubercontroller/universe/logic/api/dto"
 	"github.com/momentum-xyz/ubercontroller/universe/logic/common"
 	"github.com/momentum-xyz/ubercontroller/utils/umid"
 )
@@ -23,28 +23,13 @@ import (
 // Returns the guest user ID and authentication token (JWT).
 // For use in integration tests.
 func GuestAccount(ctURL *url.URL) (*umid.UMID, string, error) {
-	url := ctURL.JoinPath("/api/v4/auth/guest-token").String()
 	// retryable is current workaround for slow starting controller service
-	resp, err := retryablehttp.Post(url, "", nil)
+	client := api.NewClient(ctURL, api.WithHTTPClient(retryablehttp.NewClient().StandardClient()))
+	u, err := client.GuestToken(context.Background())
 	if err != nil {
 		return nil, "", fmt.Errorf("Error getting guest token: %w", err)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, "", fmt.Errorf("guest token: %s %s\n%s", url, resp.Status, string(body))
-	}
-
-	var u dto.User
-	d := json.NewDecoder(resp.Body)
-	err = d.Decode(&u)
-	if err != nil {
-		return nil, "", fmt.Errorf("Error decoding guest user %w", err)
-	}
-
-	token := *u.JWTToken
-
-	return &u.ID, token, nil
+	return &u.ID, client.Token(), nil
 }
 
 // fixtory blueprint for users
@@ -0,0 +1,193 @@
+package scenarios
+
+import (
+	"sync"
+	"time"
+
+	"github.com/momentum-xyz/posbus-client/pbc"
+	"github.com/momentum-xyz/posbus-client/pbc/capture"
+	"github.com/momentum-xyz/ubercontroller/pkg/cmath"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+)
+
+// Max number of sent positions to wait for the echo of.
+const maxPendingTransforms = 64
+
+// Metrics collects the measurements of all users of a run, safe for concurrent use.
+type Metrics struct {
+	mu      sync.Mutex
+	start   time.Time
+	clients []*ClientMetrics
+}
+
+// NewMetrics starts collecting metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{start: time.Now()}
+}
+
+// Client starts collecting the metrics of a single user.
+func (m *Metrics) Client(name string, userID umid.UMID) *ClientMetrics {
+	c := &ClientMetrics{
+		name:       name,
+		start:      time.Now(),
+		self:       userID,
+		in:         make(map[posbus.MsgType]*Traffic),
+		out:        make(map[posbus.MsgType]*Traffic),
+		transforms: make(map[cmath.Vec3]time.Time),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clients = append(m.clients, c)
+	return c
+}
+
+// Traffic of a message type.
+type Traffic struct {
+	Messages int `json:"messages"`
+	Bytes    int `json:"bytes"`
+}
+
+// ClientMetrics are the measurements of a single user.
+// Traffic is measured as a pbc.MetricsHook, the rest by Attach and the Observe functions.
+type ClientMetrics struct {
+	pbc.NopMetrics
+	name  string
+	self  umid.UMID
+	start time.Time
+
+	mu            sync.Mutex
+	connectTime   time.Duration
+	connectErrors int
+	dialErrors    int
+	teleportTime  latencies
+	loadTime      latencies
+	echoTime      latencies
+	pingRTT       latencies
+	reconnects    int
+	decodeErrors  int
+	in, out       map[posbus.MsgType]*Traffic
+	// Time the last teleport request was sent, zero when not teleporting.
+	teleportSent time.Time
+	// Positions send, and when.
+	transforms map[cmath.Vec3]time.Time
+}
+
+// Message counts the traffic of a message, see pbc.WithMetrics.
+func (c *ClientMetrics) Message(dir capture.Direction, msgType posbus.MsgType, size int) {
+	if posbus.MessageDataTypeById(msgType) == nil {
+		msgType = 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	traffic := c.in
+	if dir == capture.Outbound {
+		traffic = c.out
+	}
+	t, ok := traffic[msgType]
+	if !ok {
+		t = &Traffic{}
+		traffic[msgType] = t
+	}
+	t.Messages++
+	t.Bytes += size
+	if dir == capture.Outbound && msgType == posbus.TypeTeleportRequest {
+		c.teleportSent = time.Now()
+	}
+}
+
+// DecodeError counts a received message the client skipped.
+func (c *ClientMetrics) DecodeError(error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.decodeErrors++
+}
+
+// DialError counts a failed (re)connect attempt.
+func (c *ClientMetrics) DialError(error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dialErrors++
+}
+
+// PingRTT records the round trip time of a websocket ping.
+func (c *ClientMetrics) PingRTT(rtt time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pingRTT.add(rtt)
+}
+
+// StateChange counts the reconnects.
+func (c *ClientMetrics) StateChange(sc pbc.StateChange) {
+	if sc.To == pbc.StateReconnecting && sc.From != pbc.StateReconnecting {
+		c.mu.Lock()
+		c.reconnects++
+		c.mu.Unlock()
+	}
+}
+
+// Attach measures the events of a client, its traffic is measured with pbc.WithMetrics.
+func (c *ClientMetrics) Attach(client *pbc.Client) {
+	pbc.On(client, c.onSetWorld)
+	pbc.On(client, c.onUsersTransform)
+}
+
+// ObserveTransform records sending a position, to measure the time until it is echoed.
+func (c *ClientMetrics) ObserveTransform(pos cmath.Vec3) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.transforms) >= maxPendingTransforms {
+		// Not echoed, e.g. not in a world.
+		c.transforms = make(map[cmath.Vec3]time.Time)
+	}
+	c.transforms[pos] = time.Now()
+}
+
+// ObserveConnect records the result of connecting.
+func (c *ClientMetrics) ObserveConnect(d time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.connectErrors++
+		return
+	}
+	c.connectTime = d
+}
+
+// ObserveLoad records the time a world took to load completely.
+func (c *ClientMetrics) ObserveLoad(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loadTime.add(d)
+}
+
+// Time from the teleport request to the response.
+func (c *ClientMetrics) onSetWorld(*posbus.SetWorld) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.teleportSent.IsZero() {
+		c.teleportTime.add(time.Since(c.teleportSent))
+		c.teleportSent = time.Time{}
+	}
+}
+
+// Time from sending a position to the server broadcasting it.
+func (c *ClientMetrics) onUsersTransform(m *posbus.UsersTransformList) {
+	for _, ut := range m.Value {
+		if ut.ID != c.self {
+			continue
+		}
+		c.mu.Lock()
+		if sent, ok := c.transforms[ut.Transform.Position]; ok {
+			c.echoTime.add(time.Since(sent))
+			// Older ones are not going to be echoed anymore.
+			for pos, t := range c.transforms {
+				if !t.After(sent) {
+					delete(c.transforms, pos)
+				}
+			}
+		}
+		c.mu.Unlock()
+		return
+	}
+}
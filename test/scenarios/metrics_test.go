@@ -0,0 +1,146 @@
+package scenarios
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/momentum-xyz/posbus-client/pbc"
+	"github.com/momentum-xyz/posbus-client/pbc/capture"
+	"github.com/momentum-xyz/ubercontroller/pkg/cmath"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencySummary(t *testing.T) {
+	var l latencies
+	for i := 1; i <= 100; i++ {
+		l.add(time.Duration(i) * time.Millisecond)
+	}
+	s := l.summary(true)
+	assert.Equal(t, 100, s.Count)
+	assert.Equal(t, 1.0, s.Min)
+	assert.Equal(t, 50.5, s.Mean)
+	assert.Equal(t, 50.0, s.P50)
+	assert.Equal(t, 90.0, s.P90)
+	assert.Equal(t, 99.0, s.P99)
+	assert.Equal(t, 100.0, s.Max)
+	counts := make(map[float64]int)
+	for _, b := range s.Buckets {
+		counts[b.UpperBound] = b.Count
+	}
+	assert.Equal(t, map[float64]int{1: 1, 2: 1, 5: 3, 10: 5, 20: 10, 50: 30, 100: 50}, nonZero(counts))
+
+	assert.Equal(t, LatencySummary{}, (&latencies{}).summary(true))
+}
+
+func TestLatencySamplesCapped(t *testing.T) {
+	var l, total latencies
+	for i := 1; i <= 10*maxSamples; i++ {
+		l.add(time.Duration(i) * time.Microsecond)
+	}
+	assert.Len(t, l.samples, maxSamples)
+	total.merge(l)
+	total.merge(l)
+	assert.Len(t, total.samples, maxSamples)
+
+	s := total.summary(true)
+	assert.Equal(t, 20*maxSamples, s.Count)
+	assert.Equal(t, 0.001, s.Min)
+	assert.Equal(t, 10.0, s.Max)
+	assert.InDelta(t, 5.0, s.Mean, 0.001)
+	assert.InDelta(t, 5.0, s.P50, 1)
+	var buckets int
+	for _, b := range s.Buckets {
+		buckets += b.Count
+	}
+	assert.Equal(t, 20*maxSamples, buckets)
+}
+
+func nonZero(m map[float64]int) map[float64]int {
+	for k, v := range m {
+		if v == 0 {
+			delete(m, k)
+		}
+	}
+	return m
+}
+
+func TestClientMetrics(t *testing.T) {
+	self := umid.New()
+	m := NewMetrics()
+	c := m.Client("test", self)
+
+	c.ObserveConnect(20*time.Millisecond, nil)
+	c.Message(capture.Outbound, posbus.TypeTeleportRequest, 20)
+	c.Message(capture.Inbound, posbus.TypeSetWorld, 30)
+	c.onSetWorld(&posbus.SetWorld{})
+	c.ObserveLoad(100 * time.Millisecond)
+	c.Message(capture.Inbound, posbus.MsgType(0xdead), 3)
+	c.DecodeError(errors.New("unknown type"))
+	c.StateChange(pbc.StateChange{From: pbc.StateConnected, To: pbc.StateReconnecting})
+	c.StateChange(pbc.StateChange{From: pbc.StateReconnecting, To: pbc.StateReconnecting})
+	c.DialError(errors.New("refused"))
+	c.PingRTT(5 * time.Millisecond)
+	c.PingRTT(15 * time.Millisecond)
+
+	pos := cmath.Vec3{X: 1, Y: 2, Z: 3}
+	c.ObserveTransform(pos)
+	c.Message(capture.Outbound, posbus.TypeMyTransform, 40)
+	c.onUsersTransform(&posbus.UsersTransformList{Value: []posbus.UserTransform{
+		{ID: umid.New(), Transform: cmath.TransformNoScale{Position: pos}},
+		{ID: self, Transform: cmath.TransformNoScale{Position: pos}},
+	}})
+	// Only once.
+	c.onUsersTransform(&posbus.UsersTransformList{Value: []posbus.UserTransform{
+		{ID: self, Transform: cmath.TransformNoScale{Position: pos}},
+	}})
+
+	r := m.Report()
+	assert.Equal(t, 1, r.Clients)
+	assert.Equal(t, 20.0, r.ConnectTime.Max)
+	assert.Equal(t, 1, r.TeleportTime.Count)
+	assert.Equal(t, 100.0, r.LoadTime.Max)
+	assert.Equal(t, 1, r.TransformEcho.Count)
+	assert.Equal(t, 1, r.DecodeErrors)
+	assert.Equal(t, 1, r.Reconnects)
+	assert.Equal(t, 1, r.DialErrors)
+	assert.Equal(t, 2, r.PingRTT.Count)
+	assert.Equal(t, 10.0, r.PingRTT.Mean)
+	assert.Greater(t, r.MessagesInRate, 0.0)
+	assert.Equal(t, 1, r.In["set_world"].Messages)
+	assert.Equal(t, 1, r.In["invalid"].Messages)
+	assert.Equal(t, 1, r.Out["my_transform"].Messages)
+	assert.Equal(t, 2, r.MessagesOut)
+	assert.Equal(t, 60, r.BytesOut)
+	require.Len(t, r.PerClient, 1)
+	assert.Greater(t, r.PerClient[0].MessagesOutRate, 0.0)
+	totals := r.PerClient[0].Totals
+	totals.MessagesInRate, totals.MessagesOutRate = r.MessagesInRate, r.MessagesOutRate
+	assert.Equal(t, r.Totals, totals)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteJSON(&buf))
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.EqualValues(t, 1, decoded["decode_errors"])
+
+	buf.Reset()
+	require.NoError(t, r.WriteCSV(&buf))
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, []string{"test", self.String()}, rows[1][:2])
+	assert.Equal(t, len(rows[0]), len(rows[1]))
+
+	buf.Reset()
+	require.NoError(t, r.WriteTable(&buf))
+	assert.Contains(t, buf.String(), "transform echo")
+	assert.Contains(t, buf.String(), "ping rtt")
+	assert.Contains(t, buf.String(), "messages/s")
+}
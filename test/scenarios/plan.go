@@ -0,0 +1,190 @@
+package scenarios
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"gopkg.in/yaml.v3"
+)
+
+// Behaviour of the users of a cohort.
+type Behaviour string
+
+const (
+	// Fly around randomly.
+	Fly Behaviour = "fly"
+	// Stay connected, without doing anything.
+	Idle Behaviour = "idle"
+	// High five a random other user in the world, every interval.
+	HighFive Behaviour = "high-five"
+	// Lock a random object, move it a bit and unlock it again, every interval.
+	LockEdit Behaviour = "lock-edit"
+	// Teleport to another of the worlds, every interval.
+	TeleportHop Behaviour = "teleport-hop"
+)
+
+// RampProfile is the way the users of a cohort are started.
+type RampProfile string
+
+const (
+	// All users at once.
+	RampImmediate RampProfile = "immediate"
+	// Evenly spread over the ramp duration.
+	RampLinear RampProfile = "linear"
+	// In a number of equal groups, evenly spread over the ramp duration.
+	RampStep RampProfile = "step"
+)
+
+// Default time between the actions of a behaviour.
+const defaultInterval = 5 * time.Second
+
+// Plan is a load test of cohorts of users, each with their own behaviour.
+//
+// Read from YAML (or JSON) with durations as strings, e.g.:
+//
+//	duration: 10m
+//	worlds: [975cb9ca-4dfa-4d35-adc2-198ed1f12555]
+//	cohorts:
+//	  - name: flyers
+//	    count: 50
+//	    behaviour: fly
+//	    ramp: {profile: linear, duration: 1m}
+type Plan struct {
+	// Total run time, until interrupted when zero.
+	Duration time.Duration `yaml:"duration"`
+	// Seed for the random choices of the users, the same seed gives the same choices.
+	Seed int64 `yaml:"seed"`
+	// Worlds of all cohorts that do not define their own.
+	Worlds  []umid.UMID `yaml:"worlds"`
+	Cohorts []Cohort    `yaml:"cohorts"`
+}
+
+// Cohort is a group of users with the same behaviour.
+type Cohort struct {
+	Name      string    `yaml:"name"`
+	Count     int       `yaml:"count"`
+	Behaviour Behaviour `yaml:"behaviour"`
+	// Time after the start of the plan to start the ramp.
+	Start time.Duration `yaml:"start"`
+	Ramp  Ramp          `yaml:"ramp"`
+	// How long each user stays, until the end of the plan when zero.
+	Duration time.Duration `yaml:"duration"`
+	// Time between the actions of the behaviour, except for flying.
+	Interval time.Duration `yaml:"interval"`
+	// Users are spread over these worlds, the worlds of the plan when empty.
+	Worlds []umid.UMID `yaml:"worlds"`
+}
+
+// Ramp up of the users of a cohort.
+type Ramp struct {
+	// Immediate when empty.
+	Profile  RampProfile   `yaml:"profile"`
+	Duration time.Duration `yaml:"duration"`
+	// Number of groups, for the step profile.
+	Steps int `yaml:"steps"`
+}
+
+// ParsePlan reads a plan from YAML or JSON.
+// Unknown fields are an error, to catch typos.
+func ParsePlan(r io.Reader) (*Plan, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	var p Plan
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("plan: %w", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// LoadPlan reads a plan file.
+func LoadPlan(path string) (*Plan, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParsePlan(f)
+}
+
+// Validate checks if the plan can be run.
+func (p *Plan) Validate() error {
+	if len(p.Cohorts) == 0 {
+		return errors.New("plan: no cohorts")
+	}
+	for i, c := range p.Cohorts {
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if err := c.validate(p.worlds(c)); err != nil {
+			return fmt.Errorf("plan: cohort %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Cohort) validate(worlds []umid.UMID) error {
+	if c.Count <= 0 {
+		return errors.New("count must be positive")
+	}
+	switch c.Behaviour {
+	case Fly, Idle, HighFive, LockEdit:
+	case TeleportHop:
+		if len(worlds) < 2 {
+			return errors.New("teleport-hop needs at least 2 worlds")
+		}
+	default:
+		return fmt.Errorf("unknown behaviour %q", c.Behaviour)
+	}
+	if len(worlds) == 0 {
+		return errors.New("no worlds")
+	}
+	switch c.Ramp.Profile {
+	case "", RampImmediate, RampLinear:
+	case RampStep:
+		if c.Ramp.Steps <= 0 {
+			return errors.New("step ramp needs a positive number of steps")
+		}
+	default:
+		return fmt.Errorf("unknown ramp profile %q", c.Ramp.Profile)
+	}
+	if c.Start < 0 || c.Duration < 0 || c.Interval < 0 || c.Ramp.Duration < 0 {
+		return errors.New("negative duration")
+	}
+	return nil
+}
+
+// Worlds of a cohort.
+func (p *Plan) worlds(c Cohort) []umid.UMID {
+	if len(c.Worlds) > 0 {
+		return c.Worlds
+	}
+	return p.Worlds
+}
+
+// Time after the start of the ramp to start user i (of count).
+func (r Ramp) delay(i, count int) time.Duration {
+	switch r.Profile {
+	case RampLinear:
+		return r.Duration * time.Duration(i) / time.Duration(count)
+	case RampStep:
+		perStep := (count + r.Steps - 1) / r.Steps
+		return r.Duration * time.Duration(i/perStep) / time.Duration(r.Steps)
+	default:
+		return 0
+	}
+}
+
+func (c Cohort) interval() time.Duration {
+	if c.Interval > 0 {
+		return c.Interval
+	}
+	return defaultInterval
+}
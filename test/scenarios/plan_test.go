@@ -0,0 +1,136 @@
+package scenarios
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/momentum-xyz/posbus-client/pbc"
+	"github.com/momentum-xyz/posbus-client/pbc/pbctest"
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPlan(t *testing.T) {
+	plan, err := LoadPlan("plans/mixed.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, plan.Duration)
+	assert.Equal(t, []umid.UMID{umid.MustParse("975cb9ca-4dfa-4d35-adc2-198ed1f12555")}, plan.Worlds)
+	require.Len(t, plan.Cohorts, 4)
+	assert.Equal(t, Cohort{
+		Name:      "friendly",
+		Count:     10,
+		Behaviour: HighFive,
+		Start:     time.Minute,
+		Ramp:      Ramp{Profile: RampLinear, Duration: 30 * time.Second},
+		Interval:  10 * time.Second,
+	}, plan.Cohorts[2])
+}
+
+func TestParsePlanJSON(t *testing.T) {
+	plan, err := ParsePlan(strings.NewReader(`{
+		"worlds": ["975cb9ca-4dfa-4d35-adc2-198ed1f12555", "975cb9ca-4dfa-4d35-adc2-198ed1f12556"],
+		"cohorts": [{"count": 2, "behaviour": "teleport-hop", "interval": "1s"}]
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, TeleportHop, plan.Cohorts[0].Behaviour)
+	assert.Equal(t, time.Second, plan.Cohorts[0].interval())
+}
+
+func TestParsePlanInvalid(t *testing.T) {
+	for name, tc := range map[string]struct {
+		plan string
+		err  string
+	}{
+		"unknown field":     {"cohorts: [{count: 1, behavior: fly}]", "field behavior not found"},
+		"no cohorts":        {"worlds: []", "no cohorts"},
+		"no worlds":         {"cohorts: [{count: 1, behaviour: fly}]", "no worlds"},
+		"no users":          {"worlds: [975cb9ca-4dfa-4d35-adc2-198ed1f12555]\ncohorts: [{behaviour: fly}]", "count"},
+		"unknown behaviour": {"worlds: [975cb9ca-4dfa-4d35-adc2-198ed1f12555]\ncohorts: [{count: 1, behaviour: dance}]", "dance"},
+		"single world hop":  {"worlds: [975cb9ca-4dfa-4d35-adc2-198ed1f12555]\ncohorts: [{count: 1, behaviour: teleport-hop}]", "2 worlds"},
+		"step ramp":         {"worlds: [975cb9ca-4dfa-4d35-adc2-198ed1f12555]\ncohorts: [{count: 1, behaviour: fly, ramp: {profile: step}}]", "steps"},
+		"invalid world":     {"worlds: [mars]\ncohorts: [{count: 1, behaviour: fly}]", "mars"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParsePlan(strings.NewReader(tc.plan))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestRampDelay(t *testing.T) {
+	delays := func(r Ramp, count int) []time.Duration {
+		d := make([]time.Duration, count)
+		for i := range d {
+			d[i] = r.delay(i, count)
+		}
+		return d
+	}
+	s := time.Second
+	assert.Equal(t, []time.Duration{0, 0, 0}, delays(Ramp{Duration: 3 * s}, 3))
+	assert.Equal(t, []time.Duration{0, 1 * s, 2 * s}, delays(Ramp{Profile: RampLinear, Duration: 3 * s}, 3))
+	assert.Equal(t, []time.Duration{0, 0, 2 * s, 2 * s, 4 * s}, delays(Ramp{Profile: RampStep, Duration: 6 * s, Steps: 3}, 5))
+}
+
+func TestRunner(t *testing.T) {
+	worlds := []umid.UMID{umid.New(), umid.New()}
+	srv := pbctest.NewServer(t)
+	var mu sync.Mutex
+	teleports := make(map[umid.UMID]int)
+	highFives := 0
+	srv.Handle(posbus.TypeTeleportRequest, func(c *pbctest.Conn, msg posbus.Message) {
+		target := msg.(*posbus.TeleportRequest).Target
+		mu.Lock()
+		teleports[target]++
+		mu.Unlock()
+		c.SendWorld(posbus.SetWorld{ID: target}, nil, []posbus.UserData{{ID: c.Handshake.UserId}, {ID: umid.New()}})
+	})
+	srv.Handle(posbus.TypeHighFive, func(c *pbctest.Conn, msg posbus.Message) {
+		mu.Lock()
+		highFives++
+		mu.Unlock()
+	})
+
+	backend, err := url.Parse("http://pbctest")
+	require.NoError(t, err)
+	r := &Runner{
+		Backend: backend,
+		Metrics: NewMetrics(),
+		Options: []pbc.Option{pbc.WithTransport(srv.Transport())},
+		Account: func(ctx context.Context) (umid.UMID, string, error) {
+			return umid.New(), "token", nil
+		},
+	}
+	plan := &Plan{
+		Duration: 500 * time.Millisecond,
+		Worlds:   worlds,
+		Cohorts: []Cohort{
+			{Count: 3, Behaviour: Idle, Ramp: Ramp{Profile: RampLinear, Duration: 100 * time.Millisecond}},
+			{Count: 1, Behaviour: HighFive, Interval: 50 * time.Millisecond, Worlds: worlds[:1]},
+		},
+	}
+	start := time.Now()
+	require.NoError(t, r.Run(context.Background(), plan))
+	assert.GreaterOrEqual(t, time.Since(start), plan.Duration)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Spread over the worlds by index.
+	assert.Equal(t, map[umid.UMID]int{worlds[0]: 3, worlds[1]: 1}, teleports)
+	assert.Greater(t, highFives, 2)
+
+	report := r.Metrics.Report()
+	assert.Equal(t, 4, report.Clients)
+	assert.Equal(t, 4, report.ConnectTime.Count)
+	assert.Equal(t, 4, report.TeleportTime.Count)
+	assert.Equal(t, 4, report.LoadTime.Count)
+	assert.Equal(t, 4, report.In["set_world"].Messages)
+	assert.GreaterOrEqual(t, report.Out["high_five"].Messages, highFives)
+	assert.Zero(t, report.ConnectErrors+report.DecodeErrors+report.Reconnects)
+}
@@ -0,0 +1,366 @@
+package scenarios
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
+)
+
+// Upper bounds of the latency histogram buckets, the last bucket is everything above.
+var bucketBounds = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second,
+}
+
+// Max number of samples kept of a latency for the percentiles, the rest is replaced at random.
+const maxSamples = 1000
+
+// Samples of a latency, the count, min, max, mean and buckets are exact.
+type latencies struct {
+	count    int
+	sum      time.Duration
+	min, max time.Duration
+	buckets  []int
+	samples  []time.Duration
+}
+
+func (l *latencies) add(d time.Duration) {
+	if l.count == 0 || d < l.min {
+		l.min = d
+	}
+	if l.count == 0 || d > l.max {
+		l.max = d
+	}
+	l.count++
+	l.sum += d
+	if l.buckets == nil {
+		l.buckets = make([]int, len(bucketBounds)+1)
+	}
+	l.buckets[sort.Search(len(bucketBounds), func(i int) bool { return d <= bucketBounds[i] })]++
+	// Reservoir sampling, every sample has the same chance to be kept.
+	if len(l.samples) < maxSamples {
+		l.samples = append(l.samples, d)
+	} else if i := rand.Intn(l.count); i < maxSamples {
+		l.samples[i] = d
+	}
+}
+
+// Add the latencies of other, its samples are kept (up to maxSamples) in proportion to its count.
+func (l *latencies) merge(other latencies) {
+	if other.count == 0 {
+		return
+	}
+	if l.count == 0 || other.min < l.min {
+		l.min = other.min
+	}
+	if l.count == 0 || other.max > l.max {
+		l.max = other.max
+	}
+	if l.buckets == nil {
+		l.buckets = make([]int, len(bucketBounds)+1)
+	}
+	for i, n := range other.buckets {
+		l.buckets[i] += n
+	}
+	l.sum += other.sum
+	for j, d := range other.samples {
+		// Each sample of other stands for other.count/len(other.samples) latencies.
+		n := l.count + (j+1)*other.count/len(other.samples)
+		if len(l.samples) < maxSamples {
+			l.samples = append(l.samples, d)
+		} else if i := rand.Intn(n); i < maxSamples {
+			l.samples[i] = d
+		}
+	}
+	l.count += other.count
+}
+
+// Report of a run, as JSON, CSV or a table.
+type Report struct {
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration_s"`
+	Clients  int       `json:"clients"`
+	Totals
+	// Latencies of all clients.
+	ConnectTime   LatencySummary `json:"connect_time"`
+	TeleportTime  LatencySummary `json:"teleport_time"`
+	LoadTime      LatencySummary `json:"load_time"`
+	TransformEcho LatencySummary `json:"transform_echo"`
+	PingRTT       LatencySummary `json:"ping_rtt"`
+	// Traffic of all clients, by message type.
+	In  map[string]Traffic `json:"in"`
+	Out map[string]Traffic `json:"out"`
+	// Per client.
+	PerClient []ClientReport `json:"per_client"`
+}
+
+// Totals are the counters of one or all clients.
+type Totals struct {
+	ConnectErrors int `json:"connect_errors"`
+	DialErrors    int `json:"dial_errors"`
+	Reconnects    int `json:"reconnects"`
+	DecodeErrors  int `json:"decode_errors"`
+	MessagesIn    int `json:"messages_in"`
+	BytesIn       int `json:"bytes_in"`
+	MessagesOut   int `json:"messages_out"`
+	BytesOut      int `json:"bytes_out"`
+	// Messages per second, over the time the client (or the run) took.
+	MessagesInRate  float64 `json:"messages_in_per_s"`
+	MessagesOutRate float64 `json:"messages_out_per_s"`
+}
+
+// ClientReport has the metrics of a single user.
+type ClientReport struct {
+	Name   string `json:"name"`
+	UserID string `json:"user_id"`
+	Totals
+	ConnectTime   float64        `json:"connect_time_ms"`
+	TeleportTime  LatencySummary `json:"teleport_time"`
+	LoadTime      LatencySummary `json:"load_time"`
+	TransformEcho LatencySummary `json:"transform_echo"`
+	PingRTT       LatencySummary `json:"ping_rtt"`
+}
+
+// LatencySummary of the samples of a latency, in milliseconds.
+type LatencySummary struct {
+	Count   int      `json:"count"`
+	Min     float64  `json:"min_ms"`
+	Mean    float64  `json:"mean_ms"`
+	P50     float64  `json:"p50_ms"`
+	P90     float64  `json:"p90_ms"`
+	P99     float64  `json:"p99_ms"`
+	Max     float64  `json:"max_ms"`
+	Buckets []Bucket `json:"buckets,omitempty"`
+}
+
+// Bucket of a latency histogram, with the number of samples up to the bound (and above the previous one).
+type Bucket struct {
+	// Infinite for the last bucket, encoded as null.
+	UpperBound float64 `json:"le_ms"`
+	Count      int     `json:"count"`
+}
+
+// MarshalJSON encodes the infinite bound as null.
+func (b Bucket) MarshalJSON() ([]byte, error) {
+	var le *float64
+	if !math.IsInf(b.UpperBound, 1) {
+		le = &b.UpperBound
+	}
+	return json.Marshal(struct {
+		UpperBound *float64 `json:"le_ms"`
+		Count      int      `json:"count"`
+	}{le, b.Count})
+}
+
+// Report of the metrics collected so far.
+func (m *Metrics) Report() Report {
+	m.mu.Lock()
+	clients := append([]*ClientMetrics(nil), m.clients...)
+	m.mu.Unlock()
+
+	r := Report{
+		Start:    m.start,
+		Duration: time.Since(m.start).Seconds(),
+		Clients:  len(clients),
+		In:       make(map[string]Traffic),
+		Out:      make(map[string]Traffic),
+	}
+	var connect, teleport, load, echo, rtt latencies
+	for _, c := range clients {
+		c.mu.Lock()
+		cr := ClientReport{
+			Name:          c.name,
+			UserID:        c.self.String(),
+			ConnectTime:   ms(c.connectTime),
+			TeleportTime:  c.teleportTime.summary(false),
+			LoadTime:      c.loadTime.summary(false),
+			TransformEcho: c.echoTime.summary(false),
+			PingRTT:       c.pingRTT.summary(false),
+			Totals: Totals{
+				ConnectErrors: c.connectErrors,
+				DialErrors:    c.dialErrors,
+				Reconnects:    c.reconnects,
+				DecodeErrors:  c.decodeErrors,
+			},
+		}
+		cr.MessagesIn, cr.BytesIn = addTraffic(r.In, c.in)
+		cr.MessagesOut, cr.BytesOut = addTraffic(r.Out, c.out)
+		if c.connectTime > 0 {
+			connect.add(c.connectTime)
+		}
+		teleport.merge(c.teleportTime)
+		load.merge(c.loadTime)
+		echo.merge(c.echoTime)
+		rtt.merge(c.pingRTT)
+		elapsed := time.Since(c.start).Seconds()
+		c.mu.Unlock()
+		cr.MessagesInRate, cr.MessagesOutRate = rate(cr.MessagesIn, elapsed), rate(cr.MessagesOut, elapsed)
+
+		r.ConnectErrors += cr.ConnectErrors
+		r.DialErrors += cr.DialErrors
+		r.Reconnects += cr.Reconnects
+		r.DecodeErrors += cr.DecodeErrors
+		r.MessagesIn += cr.MessagesIn
+		r.BytesIn += cr.BytesIn
+		r.MessagesOut += cr.MessagesOut
+		r.BytesOut += cr.BytesOut
+		r.PerClient = append(r.PerClient, cr)
+	}
+	r.ConnectTime = connect.summary(true)
+	r.TeleportTime = teleport.summary(true)
+	r.LoadTime = load.summary(true)
+	r.TransformEcho = echo.summary(true)
+	r.PingRTT = rtt.summary(true)
+	r.MessagesInRate, r.MessagesOutRate = rate(r.MessagesIn, r.Duration), rate(r.MessagesOut, r.Duration)
+	return r
+}
+
+// Per second, 0 for no time at all.
+func rate(n int, seconds float64) float64 {
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(n) / seconds
+}
+
+// Add the traffic of a client to the totals by type name, returns the totals of the client.
+func addTraffic(totals map[string]Traffic, traffic map[posbus.MsgType]*Traffic) (messages, bytes int) {
+	for msgType, t := range traffic {
+		name := "invalid"
+		if msgType != 0 {
+			name = posbus.MessageNameById(msgType)
+		}
+		total := totals[name]
+		total.Messages += t.Messages
+		total.Bytes += t.Bytes
+		totals[name] = total
+		messages += t.Messages
+		bytes += t.Bytes
+	}
+	return messages, bytes
+}
+
+func (l *latencies) summary(histogram bool) LatencySummary {
+	if l.count == 0 {
+		return LatencySummary{}
+	}
+	sorted := append([]time.Duration(nil), l.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	s := LatencySummary{
+		Count: l.count,
+		Min:   ms(l.min),
+		Mean:  ms(l.sum / time.Duration(l.count)),
+		P50:   ms(percentile(sorted, 50)),
+		P90:   ms(percentile(sorted, 90)),
+		P99:   ms(percentile(sorted, 99)),
+		Max:   ms(l.max),
+	}
+	if histogram {
+		s.Buckets = make([]Bucket, len(bucketBounds)+1)
+		for i, b := range bucketBounds {
+			s.Buckets[i].UpperBound = ms(b)
+		}
+		s.Buckets[len(bucketBounds)].UpperBound = math.Inf(1)
+		for i, n := range l.buckets {
+			s.Buckets[i].Count = n
+		}
+	}
+	return s
+}
+
+// Nearest rank percentile, of sorted samples.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// WriteJSON writes the complete report.
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes a row per client.
+func (r Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"name", "user_id", "connect_ms", "connect_errors", "dial_errors", "reconnects", "decode_errors",
+		"teleports", "teleport_p50_ms", "teleport_max_ms", "load_p50_ms", "load_max_ms",
+		"echoes", "echo_p50_ms", "echo_p99_ms", "pings", "rtt_p50_ms", "rtt_max_ms",
+		"messages_in", "bytes_in", "messages_out", "bytes_out", "messages_in_per_s", "messages_out_per_s",
+	})
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	i := strconv.Itoa
+	for _, c := range r.PerClient {
+		cw.Write([]string{
+			c.Name, c.UserID, f(c.ConnectTime), i(c.ConnectErrors), i(c.DialErrors), i(c.Reconnects), i(c.DecodeErrors),
+			i(c.TeleportTime.Count), f(c.TeleportTime.P50), f(c.TeleportTime.Max), f(c.LoadTime.P50), f(c.LoadTime.Max),
+			i(c.TransformEcho.Count), f(c.TransformEcho.P50), f(c.TransformEcho.P99),
+			i(c.PingRTT.Count), f(c.PingRTT.P50), f(c.PingRTT.Max),
+			i(c.MessagesIn), i(c.BytesIn), i(c.MessagesOut), i(c.BytesOut), f(c.MessagesInRate), f(c.MessagesOutRate),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteTable writes a human readable summary.
+func (r Report) WriteTable(w io.Writer) error {
+	fmt.Fprintf(w, "%d clients in %.1fs: %d connect errors, %d dial errors, %d reconnects, %d decode errors\n",
+		r.Clients, r.Duration, r.ConnectErrors, r.DialErrors, r.Reconnects, r.DecodeErrors)
+	fmt.Fprintf(w, "%.1f messages/s in, %.1f messages/s out\n\n", r.MessagesInRate, r.MessagesOutRate)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "latency (ms)\tcount\tmin\tmean\tp50\tp90\tp99\tmax\t")
+	for _, l := range []struct {
+		name string
+		s    LatencySummary
+	}{
+		{"connect", r.ConnectTime},
+		{"teleport", r.TeleportTime},
+		{"load", r.LoadTime},
+		{"transform echo", r.TransformEcho},
+		{"ping rtt", r.PingRTT},
+	} {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t\n",
+			l.name, l.s.Count, l.s.Min, l.s.Mean, l.s.P50, l.s.P90, l.s.P99, l.s.Max)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "message type\tin\tbytes in\tout\tbytes out\t")
+	types := make(map[string]bool)
+	for name := range r.In {
+		types[name] = true
+	}
+	for name := range r.Out {
+		types[name] = true
+	}
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		in, out := r.In[name], r.Out[name]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t\n", name, in.Messages, in.Bytes, out.Messages, out.Bytes)
+	}
+	fmt.Fprintf(tw, "total\t%d\t%d\t%d\t%d\t\n", r.MessagesIn, r.BytesIn, r.MessagesOut, r.BytesOut)
+	return tw.Flush()
+}
@@ -0,0 +1,258 @@
+package scenarios
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/momentum-xyz/posbus-client/pbc"
+	"github.com/momentum-xyz/posbus-client/pbc/state"
+	"github.com/momentum-xyz/posbus-client/test/fixtures"
+	"github.com/momentum-xyz/ubercontroller/pkg/cmath"
+	"github.com/momentum-xyz/ubercontroller/utils/umid"
+	"go.uber.org/zap"
+)
+
+// Runner runs plans against a controller.
+type Runner struct {
+	Backend *url.URL
+	// Options for the clients of all users.
+	Options []pbc.Option
+	// Creates the account of a user, returns its ID and token.
+	// Guest accounts when nil.
+	Account func(ctx context.Context) (umid.UMID, string, error)
+	// Collects the metrics of all users, when set.
+	Metrics *Metrics
+	// Logger for the clients, with the name of the user added to it.
+	// Default logger of the client when nil.
+	Logger *zap.Logger
+}
+
+// Run starts the users of all cohorts and waits until they are done.
+// Failures of individual users are logged, they do not stop the plan.
+func (r *Runner) Run(ctx context.Context, plan *Plan) error {
+	if err := plan.Validate(); err != nil {
+		return err
+	}
+	if plan.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, plan.Duration)
+		defer cancel()
+	}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for ci, c := range plan.Cohorts {
+		ci, c := ci, c
+		if c.Name == "" {
+			c.Name = string(c.Behaviour)
+		}
+		c.Worlds = plan.worlds(c)
+		for i := 0; i < c.Count; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				// Every user its own source, so the choices do not depend on the scheduling.
+				rnd := rand.New(rand.NewSource(plan.Seed + int64(ci)<<32 + int64(i)))
+				if !sleepUntil(ctx, start.Add(c.Start+c.Ramp.delay(i, c.Count))) {
+					return
+				}
+				if err := r.runUser(ctx, c, i, rnd); err != nil {
+					log.Printf("%s %d: %s", c.Name, i, err)
+				}
+			}(i)
+		}
+	}
+	wg.Wait()
+	return nil
+}
+
+// Run a single user of a cohort, until its duration is over or ctx is done.
+// Seeded from the user ID when rnd is nil.
+func (r *Runner) runUser(ctx context.Context, c Cohort, i int, rnd *rand.Rand) error {
+	if c.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Duration)
+		defer cancel()
+	}
+	account := r.Account
+	if account == nil {
+		account = guestAccount(r.Backend)
+	}
+	name := fmt.Sprintf("%s %d", c.Name, i)
+	userID, token, err := account(ctx)
+	if err != nil {
+		if r.Metrics != nil {
+			r.Metrics.Client(name, umid.Nil).ObserveConnect(0, err)
+		}
+		return fmt.Errorf("account: %w", err)
+	}
+	if rnd == nil {
+		rnd = rand.New(rand.NewSource(int64(userID.ClockSequence())))
+	}
+
+	opts := r.Options
+	var metrics *ClientMetrics
+	if r.Metrics != nil {
+		metrics = r.Metrics.Client(name, userID)
+		opts = append(opts[:len(opts):len(opts)], pbc.WithMetrics(metrics))
+	}
+	if r.Logger != nil {
+		opts = append(opts[:len(opts):len(opts)], pbc.WithLogger(r.Logger.With(zap.String("client", name))))
+	}
+	client := pbc.NewClient(opts...)
+	defer client.Close()
+	s := &scenario{
+		name:    name,
+		client:  client,
+		self:    userID,
+		world:   state.New(userID),
+		worlds:  c.Worlds,
+		rnd:     rnd,
+		metrics: metrics,
+	}
+	client.SetCallback(nil)
+	client.OnAny(s.world.Handle)
+	pbc.On(client, s.onTransform)
+	if metrics != nil {
+		metrics.Attach(client)
+	}
+	url := r.Backend.JoinPath("/posbus").String()
+	start := time.Now()
+	err = client.Connect(ctx, url, token, userID)
+	if metrics != nil {
+		metrics.ObserveConnect(time.Since(start), err)
+	}
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	if err := s.teleport(ctx, c.Worlds[i%len(c.Worlds)]); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("teleport: %w", err)
+	}
+	log.Printf("%s running", s.name)
+
+	var interval time.Duration
+	var act func(ctx context.Context, step time.Duration)
+	switch c.Behaviour {
+	case Idle:
+		<-ctx.Done()
+		return nil
+	case Fly:
+		interval, act = POS_UPDATE_TIME, s.moveUser
+	case HighFive:
+		interval, act = c.interval(), s.highFive
+	case LockEdit:
+		interval, act = c.interval(), s.lockEdit
+	case TeleportHop:
+		interval, act = c.interval(), s.teleportHop
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			act(ctx, interval)
+		}
+	}
+}
+
+// High five a random other user.
+func (s *scenario) highFive(ctx context.Context, _ time.Duration) {
+	users := s.world.Users()
+	s.rnd.Shuffle(len(users), func(i, j int) { users[i], users[j] = users[j], users[i] })
+	for _, u := range users {
+		if u.ID != s.self {
+			if err := s.client.HighFive(ctx, u.ID, "H5!"); err != nil {
+				s.logf("high five: %s", err)
+			}
+			return
+		}
+	}
+}
+
+// Lock a random object, move it a bit and unlock it again.
+func (s *scenario) lockEdit(ctx context.Context, _ time.Duration) {
+	objects := s.world.Objects()
+	if len(objects) == 0 {
+		return
+	}
+	o := objects[s.rnd.Intn(len(objects))]
+	result, err := s.client.LockObject(ctx, o.ID)
+	if err != nil {
+		s.logf("lock: %s", err)
+		return
+	}
+	if !result.Locked {
+		return
+	}
+	t := o.Transform
+	t.Position.Plus(cmath.Vec3{X: randomF(s.rnd, -1, 1), Y: randomF(s.rnd, -1, 1), Z: randomF(s.rnd, -1, 1)})
+	if err := s.client.SetObjectTransform(ctx, o.ID, t); err != nil {
+		s.logf("move object: %s", err)
+	}
+	if err := s.client.UnlockObject(ctx, o.ID); err != nil {
+		s.logf("unlock: %s", err)
+	}
+}
+
+// Teleport to another world.
+func (s *scenario) teleportHop(ctx context.Context, _ time.Duration) {
+	current := s.world.Info().ID
+	var others []umid.UMID
+	for _, w := range s.worlds {
+		if w != current {
+			others = append(others, w)
+		}
+	}
+	if len(others) == 0 {
+		return
+	}
+	if err := s.teleport(ctx, others[s.rnd.Intn(len(others))]); err != nil && ctx.Err() == nil {
+		s.logf("teleport: %s", err)
+	}
+}
+
+func (s *scenario) teleport(ctx context.Context, world umid.UMID) error {
+	summary, err := s.client.Teleport(ctx, world)
+	if err != nil {
+		return err
+	}
+	if s.metrics != nil {
+		s.metrics.ObserveLoad(summary.LoadTime)
+	}
+	return nil
+}
+
+func (s *scenario) logf(format string, args ...any) {
+	log.Printf("%s %s", s.name, fmt.Sprintf(format, args...))
+}
+
+func guestAccount(backend *url.URL) func(ctx context.Context) (umid.UMID, string, error) {
+	return func(ctx context.Context) (umid.UMID, string, error) {
+		userID, token, err := fixtures.GuestAccount(backend)
+		if err != nil {
+			return umid.Nil, "", err
+		}
+		return *userID, token, nil
+	}
+}
+
+// Wait until t, returns false when ctx is done first.
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
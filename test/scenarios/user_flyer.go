@@ -2,15 +2,13 @@ package scenarios
 
 import (
 	"context"
-	"fmt"
-	"log"
 	"math"
 	"math/rand"
 	"net/url"
 	"time"
 
 	"github.com/momentum-xyz/posbus-client/pbc"
-	"github.com/momentum-xyz/posbus-client/test/fixtures"
+	"github.com/momentum-xyz/posbus-client/pbc/state"
 	"github.com/momentum-xyz/ubercontroller/pkg/cmath"
 	"github.com/momentum-xyz/ubercontroller/pkg/posbus"
 	"github.com/momentum-xyz/ubercontroller/utils/umid"
@@ -28,62 +26,34 @@ const MIN = -100
 const MAX = 100
 
 // Test scenario of a guest user flying around in a world.
-func GuestFlyer(ctx context.Context, i uint64, backend *url.URL, world *umid.UMID) error {
-	userID, token, err := fixtures.GuestAccount(backend)
-	if err != nil {
-		return fmt.Errorf("User for guest flyer scenario: %w", err)
-	}
-
-	client := pbc.NewClient()
-	us := &scenario{
-		index:  i,
-		client: client,
-		rnd:    rand.New(rand.NewSource(int64(userID.ClockSequence()))),
-	}
-	client.SetCallback(us.onMessage)
-	url := backend.JoinPath("/posbus").String()
-	client.Connect(ctx, url, token, *userID)
-	client.Send(
-		posbus.BinMessage(
-			&posbus.TeleportRequest{Target: *world},
-		),
-	)
-
-	log.Printf("Guest flyer %d running", i)
-	ticker := time.NewTicker(POS_UPDATE_TIME)
-	for {
-		select {
-		case <-ctx.Done():
-			ticker.Stop()
-			return nil
-		case <-ticker.C:
-			us.moveUser(POS_UPDATE_TIME)
-		}
-	}
+func GuestFlyer(ctx context.Context, i uint64, backend *url.URL, world *umid.UMID, opts ...pbc.Option) error {
+	r := &Runner{Backend: backend, Options: opts}
+	c := Cohort{Name: "Guest flyer", Behaviour: Fly, Worlds: []umid.UMID{*world}}
+	return r.runUser(ctx, c, int(i), nil)
 }
 
+// State of a single user of a scenario.
 type scenario struct {
-	index    uint64
+	name     string
 	client   *pbc.Client
+	self     umid.UMID
+	world    *state.World
+	worlds   []umid.UMID
 	position cmath.Vec3
 	rotation cmath.Vec3
 	moving   bool
 	target   cmath.Vec3
 	rnd      *rand.Rand
+	metrics  *ClientMetrics
 }
 
-func (s *scenario) onMessage(msg posbus.Message) {
-	switch m := msg.(type) {
-	case *posbus.MyTransform:
-		s.position = m.Position
-		s.rotation = m.Rotation
-		s.moving = true
-	default:
-		return
-	}
+func (s *scenario) onTransform(m *posbus.MyTransform) {
+	s.position = m.Position
+	s.rotation = m.Rotation
+	s.moving = true
 }
 
-func (s *scenario) moveUser(step time.Duration) {
+func (s *scenario) moveUser(ctx context.Context, step time.Duration) {
 	distance := cmath.Distance(&s.position, &s.target)
 	amount := float32(step.Seconds() * SPEED_CRUISE)
 	if distance < float64(amount) { // close enough!
@@ -95,14 +65,17 @@ func (s *scenario) moveUser(step time.Duration) {
 	s.position.Plus(move)
 	s.rotation = direction // TODO: calc euler angles here
 
-	nPos := &posbus.MyTransform{
+	nPos := cmath.TransformNoScale{
 		Position: s.position,
 		Rotation: s.rotation,
 	}
 	//fmt.Printf("Move %d: %+v\n", s.index, nPos)
-	s.client.Send(
-		posbus.BinMessage(nPos),
-	)
+	if s.metrics != nil {
+		s.metrics.ObserveTransform(s.position)
+	}
+	if err := s.client.Move(ctx, nPos); err != nil {
+		s.logf("move: %s", err)
+	}
 }
 
 // Set a random target location for the use to fly to.
@@ -1,4 +1,4 @@
-import type { PosbusPort } from "./types";
+import type { LogLevel, PosbusPort, WorldSummary } from "./types";
 import { PostMessageType, workerCall } from "./worker_messaging";
 
 
@@ -28,8 +28,18 @@ export class Client {
     this.worker.postMessage({ type: PostMessageType.DISCONNECT });
   }
 
-  async teleport(worldId: string): Promise<void> {
-    this.worker.postMessage({ type: PostMessageType.TELEPORT, world: worldId });
+  /**
+   * Teleport to a world, resolves once the world is loaded.
+   */
+  async teleport(worldId: string): Promise<WorldSummary> {
+    return workerCall(this.worker, { type: PostMessageType.TELEPORT, world: worldId });
+  }
+
+  /**
+   * Set the level of the logs of the client, default is debug.
+   */
+  setLogLevel(level: LogLevel): void {
+    this.worker.postMessage({ type: PostMessageType.LOG_LEVEL, level });
   }
 }
 
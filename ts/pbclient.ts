@@ -1,14 +1,15 @@
 import "../build/wasm_exec";
 import wasmUrl from "../build/pbc.wasm";
-import type { PosbusEvent, PosbusPort } from "./types";
+import type { LogLevel, PosbusEvent, PosbusPort, WorldSummary } from "./types";
 import type { PosbusMessage } from "../build/channel_types";
 
 declare const PBC: {
   connect: (url: string, token: string, userId: string) => Promise<void>;
   disconnect: () => void;
   setPort: (port: MessagePort) => void;
-  teleport: (world: string) => void;
-  send: (msgType: string, data: any) => void;
+  teleport: (world: string) => Promise<WorldSummary>;
+  send: (msgType: string, data: any) => Promise<void>;
+  setLogLevel: (level: LogLevel) => void;
 };
 
 interface LoadedWasm {
@@ -58,7 +59,9 @@ export class PBClient {
     port2.onmessage = (ev) => {
       const [msgType, data] = ev.data;
       // TODO: avoid the stringify
-      PBC.send(msgType, JSON.stringify(data));
+      PBC.send(msgType, JSON.stringify(data)).catch((err) => {
+        console.warn("PBC send", msgType, err);
+      });
     };
     await this._getPBC().connect(url, token, userId);
     return port1;
@@ -68,13 +71,23 @@ export class PBClient {
     this._getPBC().disconnect();
   }
 
-  teleport(world: string) {
-    this._getPBC().teleport(world);
+  /**
+   * Teleport to a world, resolves once the world is loaded.
+   */
+  async teleport(world: string): Promise<WorldSummary> {
+    return this._getPBC().teleport(world);
+  }
+
+  /**
+   * Set the level of the logs of the client, default is debug.
+   */
+  setLogLevel(level: LogLevel) {
+    this._getPBC().setLogLevel(level);
   }
 
-  send(msg: PosbusMessage) {
+  async send(msg: PosbusMessage): Promise<void> {
     const [msgType, data] = msg;
-    this._getPBC().send(msgType, JSON.stringify(data));
+    await this._getPBC().send(msgType, JSON.stringify(data));
   }
 
   private pbc: typeof PBC | null = null;
@@ -18,4 +18,21 @@ export interface PosbusPort extends MessagePort {
   postMessage: (message: msg.PosbusMessage) => void;
 }
 
+/**
+ * Summary of a world, once it is loaded after teleporting.
+ */
+export interface WorldSummary {
+  id: string;
+  name: string;
+  owner: string;
+  objects: number; // Number of objects in the world.
+  users: number; // Number of users in the world, including yourself.
+  load_time_ms: number;
+}
+
+/**
+ * Level of the logs of the client, written to the console.
+ */
+export type LogLevel = "debug" | "info" | "warn" | "error";
+
 export type * as posbus from "../build/posbus";
@@ -1,5 +1,6 @@
 import "../build/wasm_exec";
 import wasmUrl from "../build/pbc.wasm";
+import type { LogLevel, WorldSummary } from "./types";
 import { PostMessageType } from "./worker_messaging";
 
 // Exported from above wasm
@@ -7,8 +8,9 @@ declare const PBC: {
   connect: (url: string, token: string, userId: string) => Promise<void>;
   disconnect: () => void;
   setPort: (port: MessagePort) => void;
-  teleport: (world: string) => void;
-  send: (msgType: string, data: any) => void;
+  teleport: (world: string) => Promise<WorldSummary>;
+  send: (msgType: string, data: any) => Promise<void>;
+  setLogLevel: (level: LogLevel) => void;
 };
 
 let msgPort: MessagePort | null = null;
@@ -37,7 +39,9 @@ onmessage = async (e: MessageEvent) => {
         msgPort.onmessage = (ev) => {
           const [msgType, data] = ev.data;
           // TODO: avoid the stringify
-          PBC.send(msgType, JSON.stringify(data));
+          PBC.send(msgType, JSON.stringify(data)).catch((err) => {
+            console.warn("PBC send", msgType, err);
+          });
         };
       }
       break;
@@ -56,9 +60,18 @@ onmessage = async (e: MessageEvent) => {
       PBC.disconnect();
       break;
     }
+    case PostMessageType.LOG_LEVEL: {
+      PBC.setLogLevel(e.data.level);
+      break;
+    }
     case PostMessageType.TELEPORT: {
       const { world } = e.data;
-      PBC.teleport(world);
+      try {
+        const summary = await PBC.teleport(world);
+        e.ports[0]?.postMessage(summary);
+      } catch (err) {
+        e.ports[0]?.postMessage({ type: PostMessageType.ERROR, err });
+      }
       break;
     }
     default:
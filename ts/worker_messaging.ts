@@ -12,6 +12,7 @@ export const enum PostMessageType {
   DISCONNECT = "PBC_DISC", // Indicate connection should be closed.
   MSG_PORT = "PBC_PORT", // Message to send communication port to worker.
   TELEPORT = "PBC_TP", // Teleport to a world.
+  LOG_LEVEL = "PBC_LOG", // Set the level of the logs of the client.
 }
 
 /**